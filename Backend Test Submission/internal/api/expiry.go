@@ -0,0 +1,133 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"12217467/backend_test_submission/internal/models"
+	"12217467/backend_test_submission/internal/utils"
+)
+
+// ExpiryPolicy bounds the expiry clients may request
+type ExpiryPolicy struct {
+	// MaxValidity caps how long links stay valid after they start, which is
+	// when they are created or scheduled to activate (0 means no cap)
+	MaxValidity time.Duration
+
+	// AllowNeverExpires lets clients create links that never expire
+	AllowNeverExpires bool
+}
+
+// WithExpiryPolicy sets the limits on requested expiries. By default there
+// is no maximum validity and every link expires.
+func WithExpiryPolicy(policy ExpiryPolicy) Option {
+	return func(h *Handler) {
+		h.expiryPolicy = policy
+	}
+}
+
+// expiryRequest holds the mutually exclusive ways a request can set the
+// expiry of a link
+type expiryRequest struct {
+	validity     *int       // Minutes
+	validFor     string     // ISO-8601 duration
+	expiresAt    *time.Time // Absolute time
+	neverExpires bool
+}
+
+// fields returns how many ways of setting the expiry r uses
+func (r expiryRequest) fields() int {
+	n := 0
+	for _, set := range []bool{r.validity != nil, r.validFor != "", r.expiresAt != nil, r.neverExpires} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// maxValidityMinutes is the longest validity in minutes that fits in a
+// time.Duration
+const maxValidityMinutes = math.MaxInt64 / int64(time.Minute)
+
+// resolveExpiry returns the expiry asked for by req for a link whose
+// validity begins at start, falling back to DefaultValidityMinutes (within
+// MaxValidity) if req sets none. It responds with an error for conflicting
+// or nonsensical values and for expiries the policy does not allow.
+func (h *Handler) resolveExpiry(w http.ResponseWriter, req expiryRequest, start time.Time) (time.Time, bool) {
+	var expiresAt time.Time
+	switch {
+	case req.fields() > 1:
+		h.respondWithError(w, http.StatusBadRequest, "Conflicting expiry", "Use only one of validity, validFor, expiresAt and neverExpires")
+		return time.Time{}, false
+	case req.neverExpires:
+		if !h.expiryPolicy.AllowNeverExpires {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid expiry", "Links that never expire are not allowed")
+			return time.Time{}, false
+		}
+		return models.NeverExpires, true
+	case req.validity != nil:
+		if *req.validity <= 0 || int64(*req.validity) > maxValidityMinutes {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid expiry", "validity must be a positive number of minutes")
+			return time.Time{}, false
+		}
+		expiresAt = start.Add(time.Duration(*req.validity) * time.Minute)
+	case req.validFor != "":
+		d, err := utils.ParseISODuration(req.validFor)
+		if err != nil {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid expiry", err.Error())
+			return time.Time{}, false
+		}
+		expiresAt = d.AddTo(start)
+	case req.expiresAt != nil:
+		expiresAt = *req.expiresAt
+	default:
+		validity := DefaultValidityMinutes * time.Minute
+		if max := h.expiryPolicy.MaxValidity; max > 0 && validity > max {
+			validity = max
+		}
+		expiresAt = start.Add(validity)
+	}
+
+	// The expiry must lie within the link's lifetime and before the
+	// sentinel of links that never expire
+	if !expiresAt.After(start) {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid expiry", "The expiry must be in the future and after activatesAt")
+		return time.Time{}, false
+	}
+	if !expiresAt.Before(models.NeverExpires) {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid expiry",
+			"The expiry must be before "+models.NeverExpires.Format(time.RFC3339)+"; use neverExpires for links that never expire")
+		return time.Time{}, false
+	}
+	if !h.checkMaxValidity(w, start, expiresAt) {
+		return time.Time{}, false
+	}
+	return expiresAt, true
+}
+
+// checkMaxValidity responds with an error if a link valid from start until
+// expiresAt would stay valid longer than MaxValidity allows
+func (h *Handler) checkMaxValidity(w http.ResponseWriter, start, expiresAt time.Time) bool {
+	if max := h.expiryPolicy.MaxValidity; max > 0 && expiresAt.Sub(start) > max {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid expiry", fmt.Sprintf("Links may be valid for at most %s", max))
+		return false
+	}
+	return true
+}
+
+// validityStart returns when the validity period of a link activating at
+// activatesAt begins: at activation, or now if that has passed
+func validityStart(now, activatesAt time.Time) time.Time {
+	if activatesAt.After(now) {
+		return activatesAt
+	}
+	return now
+}
+
+// neverExpires reports whether shortURL was created to never expire
+func neverExpires(shortURL models.ShortURL) bool {
+	return shortURL.ExpiresAt.Equal(models.NeverExpires)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"12217467/backend_test_submission/internal/models"
+	"12217467/backend_test_submission/internal/storage"
+)
+
+// WithDefaultFallbackURL sends visitors of expired links that have no
+// fallback of their own to rawURL instead of showing an error
+func WithDefaultFallbackURL(rawURL string) Option {
+	return func(h *Handler) {
+		h.defaultFallbackURL = rawURL
+	}
+}
+
+// respondGone answers a redirect to shortURL, which has expired or used up
+// its clicks as reported by err. Visitors are sent to the fallback
+// destination if there is one; otherwise browsers get an HTML page and API
+// clients a JSON error.
+func (h *Handler) respondGone(w http.ResponseWriter, r *http.Request, shortURL models.ShortURL, err error) {
+	fallback := shortURL.FallbackURL
+	if fallback == "" {
+		fallback = h.defaultFallbackURL
+	}
+	if fallback != "" {
+		h.logger.Info("Redirecting to fallback URL", map[string]interface{}{
+			"shortcode": shortURL.ID,
+			"url":       fallback,
+			"reason":    err.Error(),
+		})
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, fallback, http.StatusFound)
+		return
+	}
+
+	if h.pages == nil || !prefersHTML(r) {
+		h.respondWithLookupError(w, err)
+		return
+	}
+	h.renderPage(w, http.StatusGone, expiredPage, map[string]interface{}{
+		"Shortcode":    shortURL.ID,
+		"ClickLimited": errors.Is(err, storage.ErrClickLimitReached),
+	})
+}
+
+// gone reports whether err means a link no longer works, rather than that
+// it never existed or could not be looked up
+func gone(err error) bool {
+	return errors.Is(err, storage.ErrShortcodeExpired) || errors.Is(err, storage.ErrClickLimitReached)
+}
+
+// prefersHTML reports whether the client making r would rather have an HTML
+// page than JSON. Wildcards count toward JSON, so API clients that accept
+// anything keep getting JSON errors.
+func prefersHTML(r *http.Request) bool {
+	var htmlQuality, jsonQuality float64
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(accepted)
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "text/html":
+			if quality > htmlQuality {
+				htmlQuality = quality
+			}
+		case "application/json", "*/*":
+			if quality > jsonQuality {
+				jsonQuality = quality
+			}
+		}
+	}
+	return htmlQuality > jsonQuality
+}
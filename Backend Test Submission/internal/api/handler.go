@@ -1,40 +1,190 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"12217467/backend_test_submission/internal/middleware"
 	"12217467/backend_test_submission/internal/models"
+	"12217467/backend_test_submission/internal/ratelimit"
+	"12217467/backend_test_submission/internal/reputation"
 	"12217467/backend_test_submission/internal/storage"
+	"12217467/backend_test_submission/internal/urlpolicy"
 	"12217467/backend_test_submission/internal/utils"
 )
 
 const (
 	// DefaultValidityMinutes is the default validity period in minutes
 	DefaultValidityMinutes = 30
+
+	// DefaultRedirectType is the status used by links that do not pick one
+	DefaultRedirectType = http.StatusFound
+
+	// permanentRedirectMaxAge caps how long clients may cache permanent
+	// redirects, so that a link can still be fixed or deleted
+	permanentRedirectMaxAge = 24 * time.Hour
+
+	// maxGenerateAttempts is how many generated shortcodes are tried before
+	// giving up on a create request
+	maxGenerateAttempts = 8
+
+	// collisionsPerLengthIncrease is how many collisions at one length are
+	// tolerated before generated shortcodes grow by one character
+	collisionsPerLengthIncrease = 2
+
+	// clickRecordTimeout bounds how long recording a click may take once the
+	// redirect has already been sent
+	clickRecordTimeout = 5 * time.Second
+
+	// reputationCheckTimeout bounds the reputation lookup a redirect waits
+	// for when no verdict is cached
+	reputationCheckTimeout = 2 * time.Second
+
+	// DefaultNotActiveStatus answers redirects to links that are not active
+	// yet
+	DefaultNotActiveStatus = http.StatusTooEarly
 )
 
 // Handler handles the API requests
 type Handler struct {
 	store  storage.URLStore
 	logger middleware.Logger
+
+	// generator produces shortcodes when the client does not pick one
+	generator utils.Generator
+
+	// caseInsensitive folds shortcodes to lower case so that "Promo" and
+	// "promo" name the same link
+	caseInsensitive bool
+
+	// authRequired rejects anonymous requests to create or manage short URLs
+	authRequired bool
+
+	// urlPolicy decides which destination URLs may be shortened
+	urlPolicy *urlpolicy.Policy
+
+	// checker looks destinations up in reputation sources, and
+	// reputationAction decides what happens to flagged ones
+	checker          reputation.URLChecker
+	reputationAction reputation.Action
+
+	// pages holds the HTML page templates
+	pages *template.Template
+
+	// passwordAttempts throttles password guessing on protected links
+	passwordAttempts     ratelimit.Store
+	passwordAttemptLimit ratelimit.Limit
+
+	// cookieSecret signs the cookies of unlocked links
+	cookieSecret []byte
+
+	// notActiveStatus answers redirects to links that are not active yet
+	notActiveStatus int
+
+	// expiryPolicy bounds the expiry clients may request
+	expiryPolicy ExpiryPolicy
+
+	// defaultFallbackURL receives visitors of expired links that have no
+	// fallback of their own
+	defaultFallbackURL string
+}
+
+// Option customizes a Handler
+type Option func(*Handler)
+
+// WithGenerator sets the strategy used to generate shortcodes
+func WithGenerator(generator utils.Generator) Option {
+	return func(h *Handler) {
+		h.generator = generator
+	}
+}
+
+// WithCaseInsensitiveShortcodes makes shortcodes case-insensitive. Codes are
+// stored in lower case, so links created with upper-case letters before the
+// option was enabled become unreachable.
+func WithCaseInsensitiveShortcodes() Option {
+	return func(h *Handler) {
+		h.caseInsensitive = true
+	}
+}
+
+// WithAuthRequired requires an authenticated caller to create short URLs.
+// Without it, anonymous callers may create links that anyone can manage.
+func WithAuthRequired() Option {
+	return func(h *Handler) {
+		h.authRequired = true
+	}
+}
+
+// WithURLPolicy sets the policy destination URLs must satisfy
+func WithURLPolicy(policy *urlpolicy.Policy) Option {
+	return func(h *Handler) {
+		h.urlPolicy = policy
+	}
+}
+
+// WithURLChecker checks destinations for phishing and malware when links are
+// created or changed and again on redirect. Flagged links are rejected or
+// shown behind a warning page, depending on action.
+func WithURLChecker(checker reputation.URLChecker, action reputation.Action) Option {
+	return func(h *Handler) {
+		h.checker = checker
+		h.reputationAction = action
+	}
+}
+
+// WithNotActiveStatus sets the status returned for links that are not
+// active yet: http.StatusTooEarly (the default) or http.StatusNotFound to
+// hide that they exist
+func WithNotActiveStatus(status int) Option {
+	return func(h *Handler) {
+		h.notActiveStatus = status
+	}
 }
 
 // NewHandler creates a new Handler
-func NewHandler(store storage.URLStore, logger middleware.Logger) *Handler {
-	return &Handler{
-		store:  store,
-		logger: logger,
+func NewHandler(store storage.URLStore, logger middleware.Logger, opts ...Option) *Handler {
+	h := &Handler{
+		store:     store,
+		logger:    logger,
+		generator: utils.RandomGenerator{},
+		urlPolicy: urlpolicy.New(urlpolicy.Config{}),
+
+		passwordAttempts:     ratelimit.NewMemoryStore(),
+		passwordAttemptLimit: DefaultPasswordAttemptLimit,
+		notActiveStatus:      DefaultNotActiveStatus,
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	if len(h.cookieSecret) == 0 {
+		h.cookieSecret = randomCookieSecret()
+	}
+	return h
 }
 
 // CreateShortURL handles the creation of a new short URL
 func (h *Handler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
+	// Check authentication
+	principal, authenticated := middleware.PrincipalFromContext(r.Context())
+	if h.authRequired && !authenticated {
+		h.respondWithError(w, http.StatusUnauthorized, "Authentication required", "")
+		return
+	}
+	if authenticated && !principal.HasScope(middleware.ScopeCreate) && !principal.HasScope(middleware.ScopeAdmin) {
+		h.respondWithError(w, http.StatusForbidden, "Insufficient scope", "Requires scope "+middleware.ScopeCreate)
+		return
+	}
+
 	// Parse request body
 	var req models.CreateShortURLRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -43,63 +193,99 @@ func (h *Handler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate URL
-	if req.URL == "" {
-		h.respondWithError(w, http.StatusBadRequest, "URL is required", "")
+	if !h.validateURL(w, r, req.URL) {
 		return
 	}
 
-	// Validate URL format
-	if _, err := url.ParseRequestURI(req.URL); err != nil {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid URL format", err.Error())
+	// Validate fallback URL
+	if req.FallbackURL != "" && !h.validateURL(w, r, req.FallbackURL) {
 		return
 	}
 
-	// Set default validity if not provided
-	validityMinutes := DefaultValidityMinutes
-	if req.Validity != nil && *req.Validity > 0 {
-		validityMinutes = *req.Validity
+	// Validate redirect rules
+	if !h.validateRedirectRules(w, r, req.RedirectRules) {
+		return
 	}
 
-	// Generate or validate shortcode
-	shortcode := req.Shortcode
-	if shortcode == "" {
-		// Generate a random shortcode
-		var err error
-		shortcode, err = utils.GenerateShortcode(utils.DefaultShortcodeLength)
-		if err != nil {
-			h.respondWithError(w, http.StatusInternalServerError, "Failed to generate shortcode", err.Error())
-			return
-		}
-	} else {
-		// Validate custom shortcode
-		if !utils.ValidateShortcode(shortcode) {
-			h.respondWithError(w, http.StatusBadRequest, "Invalid shortcode format", "Shortcode must be alphanumeric")
-			return
-		}
+	// Validate redirect type
+	if req.RedirectType == 0 {
+		req.RedirectType = DefaultRedirectType
+	}
+	if !h.validateRedirectType(w, req.RedirectType) {
+		return
+	}
 
-		// Check if shortcode already exists
-		if h.store.ShortcodeExists(shortcode) {
-			h.respondWithError(w, http.StatusConflict, "Shortcode already exists", "")
+	// Validate click limit
+	if !h.validateMaxClicks(w, req.MaxClicks) {
+		return
+	}
+
+	// Resolve the expiry. Scheduled links are valid from their activation.
+	now := time.Now()
+	var activatesAt time.Time
+	if req.ActivatesAt != nil {
+		activatesAt = *req.ActivatesAt
+	}
+	expiresAt, ok := h.resolveExpiry(w, expiryRequest{
+		validity:     req.Validity,
+		validFor:     req.ValidFor,
+		expiresAt:    req.ExpiresAt,
+		neverExpires: req.NeverExpires,
+	}, validityStart(now, activatesAt))
+	if !ok {
+		return
+	}
+
+	// Hash the password, if any
+	passwordHash, ok := h.hashPassword(w, req.Password)
+	if !ok {
+		return
+	}
+
+	// Validate custom shortcode
+	req.Shortcode = h.canonicalShortcode(req.Shortcode)
+	if req.Shortcode != "" {
+		if err := utils.CheckShortcode(req.Shortcode); err != nil {
+			h.respondWithShortcodeError(w, err)
 			return
 		}
 	}
 
 	// Create short URL
-	now := time.Now()
 	shortURL := models.ShortURL{
-		ID:          shortcode,
-		OriginalURL: req.URL,
-		CreatedAt:   now,
-		ExpiresAt:   now.Add(time.Duration(validityMinutes) * time.Minute),
-		Clicks:      0,
-		ClickData:   []models.Click{},
+		ID:            req.Shortcode,
+		OriginalURL:   req.URL,
+		CreatedAt:     now,
+		ExpiresAt:     expiresAt,
+		Clicks:        0,
+		ClickData:     []models.Click{},
+		Owner:         principal.ID,
+		Preview:       req.Preview,
+		RedirectType:  req.RedirectType,
+		PasswordHash:  passwordHash,
+		MaxClicks:     req.MaxClicks,
+		ActivatesAt:   activatesAt,
+		FallbackURL:   req.FallbackURL,
+		RedirectRules: req.RedirectRules,
 	}
 
-	// Store the short URL
-	if err := h.store.Create(shortURL); err != nil {
+	// Store the short URL. Create reserves the shortcode atomically, so a
+	// conflict here is authoritative rather than the result of a stale check.
+	var err error
+	if shortURL.ID == "" {
+		shortURL, err = h.createWithGeneratedShortcode(r.Context(), shortURL)
+	} else {
+		err = h.store.Create(r.Context(), shortURL)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrShortcodeExists) {
+			h.respondWithError(w, http.StatusConflict, "Shortcode already exists", "")
+			return
+		}
 		h.respondWithError(w, http.StatusInternalServerError, "Failed to create short URL", err.Error())
 		return
 	}
+	shortcode := shortURL.ID
 
 	// Construct the short link
 	host := r.Host
@@ -111,49 +297,90 @@ func (h *Handler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
 
 	// Prepare response
 	resp := models.CreateShortURLResponse{
-		ShortLink: shortLink,
-		Expiry:    shortURL.ExpiresAt,
+		ShortLink:    shortLink,
+		Expiry:       shortURL.ExpiresAt,
+		NeverExpires: neverExpires(shortURL),
+		ActivatesAt:  optionalTime(shortURL.ActivatesAt),
 	}
 
 	// Log success
 	h.logger.Info("Created short URL", map[string]interface{}{
 		"shortcode": shortcode,
 		"url":       req.URL,
-		"validity":  validityMinutes,
+		"expiry":    shortURL.ExpiresAt.Format(time.RFC3339),
 	})
 
 	// Return response
 	h.respondWithJSON(w, http.StatusCreated, resp)
 }
 
+// createWithGeneratedShortcode stores shortURL under a freshly generated
+// shortcode, retrying on collisions. Generated codes grow by one character
+// after every collisionsPerLengthIncrease collisions so that a crowded
+// keyspace still converges.
+func (h *Handler) createWithGeneratedShortcode(ctx context.Context, shortURL models.ShortURL) (models.ShortURL, error) {
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		length := utils.DefaultShortcodeLength + attempt/collisionsPerLengthIncrease
+		var shortcode string
+		var err error
+		if retry, ok := h.generator.(utils.RetryGenerator); ok && attempt > 0 {
+			shortcode, err = retry.Retry(shortURL.OriginalURL, length)
+		} else {
+			shortcode, err = h.generator.Generate(shortURL.OriginalURL, length)
+		}
+		if err != nil {
+			return models.ShortURL{}, fmt.Errorf("generate shortcode: %w", err)
+		}
+		shortcode = h.canonicalShortcode(shortcode)
+
+		// Treat generated codes that hit the blocklist like collisions
+		if err := utils.CheckShortcode(shortcode); err != nil {
+			h.logger.Debug("Generated shortcode rejected", map[string]interface{}{
+				"shortcode": shortcode,
+				"reason":    err.Error(),
+			})
+			continue
+		}
+
+		shortURL.ID = shortcode
+		err = h.store.Create(ctx, shortURL)
+		if err == nil {
+			return shortURL, nil
+		}
+		if !errors.Is(err, storage.ErrShortcodeExists) {
+			return models.ShortURL{}, err
+		}
+
+		h.logger.Debug("Generated shortcode collided", map[string]interface{}{
+			"shortcode": shortcode,
+			"attempt":   attempt + 1,
+		})
+	}
+
+	return models.ShortURL{}, fmt.Errorf("no free shortcode after %d attempts", maxGenerateAttempts)
+}
+
 // GetURLStats handles the retrieval of URL statistics
 func (h *Handler) GetURLStats(w http.ResponseWriter, r *http.Request) {
 	// Extract shortcode from path
-	shortcode := strings.TrimPrefix(r.URL.Path, "/shorturls/")
+	shortcode := h.canonicalShortcode(strings.TrimPrefix(r.URL.Path, "/shorturls/"))
 
 	// Get URL from store
-	shortURL, err := h.store.Get(shortcode)
+	shortURL, err := h.getForManagement(r.Context(), shortcode)
 	if err != nil {
-		switch err {
-		case storage.ErrShortcodeNotFound:
-			h.respondWithError(w, http.StatusNotFound, "Shortcode not found", "")
-		case storage.ErrShortcodeExpired:
-			h.respondWithError(w, http.StatusGone, "Shortcode has expired", "")
-		default:
-			h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve URL", err.Error())
-		}
+		h.respondWithLookupError(w, err)
+		return
+	}
+	if !h.authorizeOwner(w, r, shortURL, middleware.ScopeReadStats) {
+		return
+	}
+	if shortURL.ClickData, err = h.store.ListClicks(r.Context(), shortcode); err != nil {
+		h.respondWithLookupError(w, err)
 		return
 	}
 
 	// Prepare response
-	resp := models.URLStatsResponse{
-		Shortcode:   shortURL.ID,
-		OriginalURL: shortURL.OriginalURL,
-		CreatedAt:   shortURL.CreatedAt,
-		ExpiresAt:   shortURL.ExpiresAt,
-		Clicks:      shortURL.Clicks,
-		ClickData:   shortURL.ClickData,
-	}
+	resp := newURLStatsResponse(shortURL)
 
 	// Log success
 	h.logger.Info("Retrieved URL stats", map[string]interface{}{
@@ -165,51 +392,268 @@ func (h *Handler) GetURLStats(w http.ResponseWriter, r *http.Request) {
 	h.respondWithJSON(w, http.StatusOK, resp)
 }
 
+// UpdateShortURL handles changing the destination or validity of a short URL.
+// A new validity is counted from now, so it can extend or shorten the link's
+// lifetime.
+func (h *Handler) UpdateShortURL(w http.ResponseWriter, r *http.Request) {
+	// Extract shortcode from path
+	shortcode := h.canonicalShortcode(strings.TrimPrefix(r.URL.Path, "/shorturls/"))
+
+	// Parse request body
+	var req models.UpdateShortURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	// Validate URL
+	if req.URL != nil && !h.validateURL(w, r, *req.URL) {
+		return
+	}
+	if req.FallbackURL != nil && *req.FallbackURL != "" && !h.validateURL(w, r, *req.FallbackURL) {
+		return
+	}
+	if req.RedirectRules != nil && !h.validateRedirectRules(w, r, *req.RedirectRules) {
+		return
+	}
+	if req.RedirectType != nil && !h.validateRedirectType(w, *req.RedirectType) {
+		return
+	}
+	if req.MaxClicks != nil && !h.validateMaxClicks(w, *req.MaxClicks) {
+		return
+	}
+
+	// Get URL from store
+	shortURL, err := h.getForManagement(r.Context(), shortcode)
+	if err != nil {
+		h.respondWithLookupError(w, err)
+		return
+	}
+	if !h.authorizeOwner(w, r, shortURL, middleware.ScopeCreate) {
+		return
+	}
+
+	// Apply changes
+	if req.URL != nil {
+		shortURL.OriginalURL = *req.URL
+	}
+	if req.ActivatesAt != nil {
+		shortURL.ActivatesAt = *req.ActivatesAt
+	}
+	expiry := expiryRequest{
+		validity:     req.Validity,
+		validFor:     req.ValidFor,
+		expiresAt:    req.ExpiresAt,
+		neverExpires: req.NeverExpires,
+	}
+	if expiry.fields() > 0 {
+		expiresAt, ok := h.resolveExpiry(w, expiry, validityStart(time.Now(), shortURL.ActivatesAt))
+		if !ok {
+			return
+		}
+		shortURL.ExpiresAt = expiresAt
+	} else if req.ActivatesAt != nil && !neverExpires(shortURL) &&
+		!h.checkMaxValidity(w, validityStart(time.Now(), shortURL.ActivatesAt), shortURL.ExpiresAt) {
+		// Moving the activation earlier lengthens the kept expiry's validity
+		return
+	}
+	if !shortURL.ActivatesAt.IsZero() && !shortURL.ActivatesAt.Before(shortURL.ExpiresAt) {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid activation time", "activatesAt must be before the expiry")
+		return
+	}
+	if req.Preview != nil {
+		shortURL.Preview = *req.Preview
+	}
+	if req.RedirectType != nil {
+		shortURL.RedirectType = *req.RedirectType
+	}
+	if req.Password != nil {
+		passwordHash, ok := h.hashPassword(w, *req.Password)
+		if !ok {
+			return
+		}
+		shortURL.PasswordHash = passwordHash
+	}
+	if req.MaxClicks != nil {
+		shortURL.MaxClicks = *req.MaxClicks
+	}
+	if req.FallbackURL != nil {
+		shortURL.FallbackURL = *req.FallbackURL
+	}
+	if req.RedirectRules != nil {
+		shortURL.RedirectRules = *req.RedirectRules
+	}
+
+	// Store the short URL
+	if err := h.store.Update(r.Context(), shortURL); err != nil {
+		h.respondWithLookupError(w, err)
+		return
+	}
+
+	// Log success
+	h.logger.Info("Updated short URL", map[string]interface{}{
+		"shortcode": shortcode,
+		"url":       shortURL.OriginalURL,
+		"expiry":    shortURL.ExpiresAt.Format(time.RFC3339),
+	})
+
+	// Return response
+	h.respondWithJSON(w, http.StatusOK, newURLStatsResponse(shortURL))
+}
+
+// DeleteShortURL handles deactivating a short URL. The shortcode and its
+// click history are removed.
+func (h *Handler) DeleteShortURL(w http.ResponseWriter, r *http.Request) {
+	// Extract shortcode from path
+	shortcode := h.canonicalShortcode(strings.TrimPrefix(r.URL.Path, "/shorturls/"))
+
+	// Get URL from store
+	shortURL, err := h.getForManagement(r.Context(), shortcode)
+	if err != nil {
+		h.respondWithLookupError(w, err)
+		return
+	}
+	if !h.authorizeOwner(w, r, shortURL, middleware.ScopeCreate) {
+		return
+	}
+
+	// Delete the short URL
+	if err := h.store.Delete(r.Context(), shortcode); err != nil {
+		h.respondWithLookupError(w, err)
+		return
+	}
+
+	// Log success
+	h.logger.Info("Deleted short URL", map[string]interface{}{
+		"shortcode": shortcode,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // RedirectURL handles the redirection to the original URL
 func (h *Handler) RedirectURL(w http.ResponseWriter, r *http.Request) {
-	// Extract shortcode from path
+	// Extract shortcode from path. A trailing "+" asks for the preview
+	// page instead of the redirect.
 	shortcode := strings.TrimPrefix(r.URL.Path, "/")
+	previewRequested := strings.HasSuffix(shortcode, "+")
+	shortcode = h.canonicalShortcode(strings.TrimSuffix(shortcode, "+"))
 
 	// Get URL from store
-	shortURL, err := h.store.Get(shortcode)
+	shortURL, err := h.store.Get(r.Context(), shortcode)
+	if errors.Is(err, storage.ErrShortcodeNotActive) {
+		h.respondNotActive(w, shortURL)
+		return
+	}
+	if gone(err) {
+		h.respondGone(w, r, shortURL, err)
+		return
+	}
 	if err != nil {
-		switch err {
-		case storage.ErrShortcodeNotFound:
-			h.respondWithError(w, http.StatusNotFound, "Shortcode not found", "")
-		case storage.ErrShortcodeExpired:
-			h.respondWithError(w, http.StatusGone, "Shortcode has expired", "")
-		default:
-			h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve URL", err.Error())
+		h.respondWithLookupError(w, err)
+		return
+	}
+
+	// Links that have used up their clicks stop working
+	if shortURL.MaxClicks > 0 && shortURL.Clicks >= shortURL.MaxClicks {
+		h.respondGone(w, r, shortURL, storage.ErrClickLimitReached)
+		return
+	}
+
+	// Ask for the password of protected links before revealing anything
+	// about the destination
+	if shortURL.PasswordHash != "" && !h.unlocked(r, shortURL) {
+		h.respondWithPasswordForm(w, r, http.StatusUnauthorized, shortcode, "")
+		return
+	}
+
+	// Pick the destination for this client
+	target, matchedRule := destination(r, shortURL)
+
+	// Interstitial pages link here with proceed=1 once the visitor has
+	// seen them
+	proceed := r.URL.Query().Get("proceed") == "1"
+	proceedURL := "/" + shortcode + "?proceed=1"
+
+	// Block or warn about destinations flagged since the link was created
+	if verdict := h.redirectVerdict(r, target); verdict.Malicious {
+		if h.reputationAction == reputation.ActionReject || h.pages == nil {
+			h.respondWithError(w, http.StatusForbidden, "Destination is flagged as malicious", describeVerdict(verdict))
+			return
 		}
+		if !proceed {
+			h.renderPage(w, http.StatusOK, warningPage, map[string]interface{}{
+				"Shortcode":   shortcode,
+				"OriginalURL": target,
+				"Threat":      verdict.Threat,
+				"ProceedURL":  proceedURL,
+			})
+			return
+		}
+	}
+
+	// Show the destination first if the link or the visitor asks for it
+	if (shortURL.Preview || previewRequested) && !proceed && h.pages != nil {
+		h.renderPage(w, http.StatusOK, previewPage, map[string]interface{}{
+			"Shortcode":   shortcode,
+			"OriginalURL": target,
+			"CreatedAt":   shortURL.CreatedAt,
+			"Clicks":      shortURL.Clicks,
+			"ProceedURL":  proceedURL,
+		})
 		return
 	}
 
 	// Record click
 	click := models.Click{
-		Timestamp: time.Now(),
-		Referrer:  r.Referer(),
-		Location:  getLocationFromIP(r.RemoteAddr),
-		UserAgent: r.UserAgent(),
+		Timestamp:   time.Now(),
+		Referrer:    r.Referer(),
+		Location:    getLocationFromIP(r.RemoteAddr),
+		UserAgent:   r.UserAgent(),
+		MatchedRule: matchedRule,
 	}
 
-	// Update click statistics asynchronously to not block the redirection
-	go func() {
-		if err := h.store.RecordClick(shortcode, click); err != nil {
-			h.logger.Error("Failed to record click", map[string]interface{}{
-				"shortcode": shortcode,
-				"error":     err.Error(),
-			})
+	// Links with a click limit record the click before redirecting, since
+	// the store decides whether the limit allows it
+	if shortURL.MaxClicks > 0 {
+		if err := h.store.RecordClick(r.Context(), shortcode, click); gone(err) {
+			h.respondGone(w, r, shortURL, err)
+			return
+		} else if err != nil {
+			h.respondWithLookupError(w, err)
+			return
 		}
-	}()
+	} else {
+		// Update click statistics asynchronously to not block the
+		// redirection. The request context ends with the response, so the
+		// click gets its own.
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), clickRecordTimeout)
+			defer cancel()
+
+			if err := h.store.RecordClick(ctx, shortcode, click); err != nil {
+				h.logger.Error("Failed to record click", map[string]interface{}{
+					"shortcode": shortcode,
+					"error":     err.Error(),
+				})
+			}
+		}()
+	}
 
 	// Log redirection
-	h.logger.Info("Redirecting to original URL", map[string]interface{}{
+	fields := map[string]interface{}{
 		"shortcode": shortcode,
-		"url":       shortURL.OriginalURL,
-	})
+		"url":       target,
+	}
+	if matchedRule != nil {
+		fields["rule"] = *matchedRule
+	}
+	h.logger.Info("Redirecting to original URL", fields)
 
-	// Redirect to original URL
-	http.Redirect(w, r, shortURL.OriginalURL, http.StatusFound)
+	// Redirect to the destination
+	status := redirectType(shortURL)
+	setRedirectCacheControl(w, shortURL, status)
+	http.Redirect(w, r, target, status)
 }
 
 // respondWithJSON sends a JSON response
@@ -240,6 +684,289 @@ func (h *Handler) respondWithError(w http.ResponseWriter, status int, message, d
 	h.respondWithJSON(w, status, errorResponse)
 }
 
+// authorizeOwner checks that the caller holds scope and owns shortURL, and
+// responds with an error if not. Callers with the admin scope may manage
+// every short URL. Links created anonymously stay open to everyone unless
+// authentication is required.
+func (h *Handler) authorizeOwner(w http.ResponseWriter, r *http.Request, shortURL models.ShortURL, scope string) bool {
+	principal, authenticated := middleware.PrincipalFromContext(r.Context())
+	if shortURL.Owner == "" && !h.authRequired {
+		return true
+	}
+	if !authenticated {
+		h.respondWithError(w, http.StatusUnauthorized, "Authentication required", "")
+		return false
+	}
+	if principal.HasScope(middleware.ScopeAdmin) {
+		return true
+	}
+	if !principal.HasScope(scope) {
+		h.respondWithError(w, http.StatusForbidden, "Insufficient scope", "Requires scope "+scope)
+		return false
+	}
+	if !ownedBy(shortURL, principal) {
+		h.respondWithError(w, http.StatusForbidden, "Short URL belongs to another owner", "")
+		return false
+	}
+	return true
+}
+
+// ownedBy reports whether principal owns shortURL. Owners recorded without
+// a source prefix predate bearer tokens and belong to API keys.
+func ownedBy(shortURL models.ShortURL, principal middleware.Principal) bool {
+	owner := shortURL.Owner
+	if !strings.HasPrefix(owner, middleware.APIKeyPrincipalPrefix) && !strings.HasPrefix(owner, middleware.JWTPrincipalPrefix) {
+		owner = middleware.APIKeyPrincipalPrefix + owner
+	}
+	return principal.ID == owner
+}
+
+// respondWithLookupError maps a store error for an existing shortcode to a
+// response
+func (h *Handler) respondWithLookupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrShortcodeNotFound):
+		h.respondWithError(w, http.StatusNotFound, "Shortcode not found", "")
+	case errors.Is(err, storage.ErrShortcodeExpired):
+		h.respondWithError(w, http.StatusGone, "Shortcode has expired", "")
+	case errors.Is(err, storage.ErrShortcodeNotActive):
+		h.respondNotActive(w, models.ShortURL{})
+	case errors.Is(err, storage.ErrClickLimitReached):
+		h.respondWithError(w, http.StatusGone, "Click limit reached", "The link has been used as many times as allowed")
+	case errors.Is(err, storage.ErrShortcodeDeleted):
+		h.respondWithError(w, http.StatusGone, "Shortcode has been deleted", "")
+	default:
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve URL", err.Error())
+	}
+}
+
+// validateURL checks that rawURL can be used as a destination and responds
+// with an error if it cannot
+func (h *Handler) validateURL(w http.ResponseWriter, r *http.Request, rawURL string) bool {
+	if rawURL == "" {
+		h.respondWithError(w, http.StatusBadRequest, "URL is required", "")
+		return false
+	}
+
+	// Validate URL format
+	if _, err := url.ParseRequestURI(rawURL); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid URL format", err.Error())
+		return false
+	}
+
+	// Validate URL safety
+	if err := h.urlPolicy.Check(rawURL, r.Host); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "URL is not allowed", err.Error())
+		return false
+	}
+
+	// Check URL reputation. Lookup failures let the URL through; the
+	// redirect checks it again.
+	if h.checker == nil {
+		return true
+	}
+	verdict, err := h.checker.Check(r.Context(), rawURL)
+	if err != nil {
+		h.logger.Error("Failed to check URL reputation", map[string]interface{}{
+			"url":   rawURL,
+			"error": err.Error(),
+		})
+		return true
+	}
+	if verdict.Malicious {
+		h.logger.Info("Destination flagged as malicious", map[string]interface{}{
+			"url":    rawURL,
+			"threat": verdict.Threat,
+			"source": verdict.Source,
+		})
+		if h.reputationAction == reputation.ActionReject {
+			h.respondWithError(w, http.StatusUnprocessableEntity, "URL is flagged as malicious", describeVerdict(verdict))
+			return false
+		}
+	}
+	return true
+}
+
+// redirectVerdict returns the reputation of a destination at redirect time.
+// Checkers that cache verdicts answer from the cache; on a miss, as after a
+// restart or on another replica, the redirect waits for a lookup bounded by
+// reputationCheckTimeout. Failed lookups let the redirect through.
+func (h *Handler) redirectVerdict(r *http.Request, rawURL string) reputation.Verdict {
+	if h.checker == nil {
+		return reputation.Verdict{}
+	}
+
+	if cache, ok := h.checker.(reputation.VerdictCache); ok {
+		if verdict, ok := cache.Cached(rawURL); ok {
+			return verdict
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), reputationCheckTimeout)
+	defer cancel()
+
+	verdict, err := h.checker.Check(ctx, rawURL)
+	if err != nil {
+		h.logger.Error("Failed to check URL reputation", map[string]interface{}{
+			"url":   rawURL,
+			"error": err.Error(),
+		})
+		return reputation.Verdict{}
+	}
+	return verdict
+}
+
+// describeVerdict explains a malicious verdict for error details
+func describeVerdict(verdict reputation.Verdict) string {
+	if verdict.Threat == "" {
+		return "Reported by " + verdict.Source
+	}
+	return fmt.Sprintf("Reported as %s by %s", verdict.Threat, verdict.Source)
+}
+
+// newURLStatsResponse reports shortURL and its click statistics
+func newURLStatsResponse(shortURL models.ShortURL) models.URLStatsResponse {
+	return models.URLStatsResponse{
+		Shortcode:         shortURL.ID,
+		OriginalURL:       shortURL.OriginalURL,
+		CreatedAt:         shortURL.CreatedAt,
+		ExpiresAt:         shortURL.ExpiresAt,
+		NeverExpires:      neverExpires(shortURL),
+		Clicks:            shortURL.Clicks,
+		ClickData:         shortURL.ClickData,
+		Preview:           shortURL.Preview,
+		RedirectType:      redirectType(shortURL),
+		PasswordProtected: shortURL.PasswordHash != "",
+		MaxClicks:         shortURL.MaxClicks,
+		ActivatesAt:       optionalTime(shortURL.ActivatesAt),
+		FallbackURL:       shortURL.FallbackURL,
+		RedirectRules:     shortURL.RedirectRules,
+	}
+}
+
+// optionalTime returns nil for the zero time, so that it is left out of
+// responses
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// getForManagement retrieves a short URL for the management endpoints,
+// which also work on links that are not active yet
+func (h *Handler) getForManagement(ctx context.Context, shortcode string) (models.ShortURL, error) {
+	shortURL, err := h.store.Get(ctx, shortcode)
+	if errors.Is(err, storage.ErrShortcodeNotActive) {
+		return shortURL, nil
+	}
+	return shortURL, err
+}
+
+// respondNotActive answers a redirect to shortURL, which is not active yet,
+// with the configured status. Answering 404 hides that the link exists.
+func (h *Handler) respondNotActive(w http.ResponseWriter, shortURL models.ShortURL) {
+	if h.notActiveStatus == http.StatusNotFound {
+		h.respondWithError(w, http.StatusNotFound, "Shortcode not found", "")
+		return
+	}
+
+	details := ""
+	if !shortURL.ActivatesAt.IsZero() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(shortURL.ActivatesAt).Seconds()))))
+		details = "Activates at " + shortURL.ActivatesAt.UTC().Format(time.RFC3339)
+	}
+	h.respondWithError(w, h.notActiveStatus, "Shortcode is not active yet", details)
+}
+
+// validateMaxClicks checks a requested click limit, responding with an
+// error if it is negative
+func (h *Handler) validateMaxClicks(w http.ResponseWriter, maxClicks int) bool {
+	if maxClicks < 0 {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid click limit", "maxClicks must not be negative")
+		return false
+	}
+	return true
+}
+
+// validateRedirectType checks that status is a redirect status links may
+// use, responding with an error if not
+func (h *Handler) validateRedirectType(w http.ResponseWriter, status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	h.respondWithError(w, http.StatusBadRequest, "Invalid redirect type", "Must be one of 301, 302, 307 or 308")
+	return false
+}
+
+// redirectType returns the status shortURL redirects with. Links stored
+// before redirect types existed use DefaultRedirectType.
+func redirectType(shortURL models.ShortURL) int {
+	if shortURL.RedirectType == 0 {
+		return DefaultRedirectType
+	}
+	return shortURL.RedirectType
+}
+
+// setRedirectCacheControl tells clients how long they may reuse a redirect.
+// Permanent redirects are cacheable until the link expires, up to
+// permanentRedirectMaxAge; temporary ones are never cached so that
+// retargeting takes effect and every click reaches the service.
+func setRedirectCacheControl(w http.ResponseWriter, shortURL models.ShortURL, status int) {
+	// The destination of links with redirect rules depends on the client
+	if len(shortURL.RedirectRules) > 0 {
+		w.Header().Set("Vary", "User-Agent")
+	}
+
+	if !cacheableRedirect(shortURL, status) {
+		w.Header().Set("Cache-Control", "private, no-store")
+		return
+	}
+
+	maxAge := time.Until(shortURL.ExpiresAt)
+	if maxAge > permanentRedirectMaxAge {
+		maxAge = permanentRedirectMaxAge
+	}
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+}
+
+// cacheableRedirect reports whether the redirect to shortURL sent with
+// status may be reused. Only permanent redirects are, and never those of
+// password-protected links, which a shared cache would hand out to visitors
+// without the password, or of links whose every visit must reach the
+// service: click-limited, scheduled and fallback links.
+func cacheableRedirect(shortURL models.ShortURL, status int) bool {
+	if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+		return false
+	}
+	return shortURL.PasswordHash == "" && shortURL.MaxClicks == 0 && shortURL.ActivatesAt.IsZero() && shortURL.FallbackURL == ""
+}
+
+// canonicalShortcode returns the form under which shortcode is stored
+func (h *Handler) canonicalShortcode(shortcode string) string {
+	if h.caseInsensitive {
+		return strings.ToLower(shortcode)
+	}
+	return shortcode
+}
+
+// respondWithShortcodeError explains why a custom shortcode was rejected:
+// malformed codes are a 400, well-formed but disallowed codes a 422
+func (h *Handler) respondWithShortcodeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, utils.ErrShortcodeReserved):
+		h.respondWithError(w, http.StatusUnprocessableEntity, "Shortcode is reserved", "The shortcode is used by the service itself")
+	case errors.Is(err, utils.ErrShortcodeBlocked):
+		h.respondWithError(w, http.StatusUnprocessableEntity, "Shortcode is not allowed", "The shortcode contains a blocked word")
+	default:
+		h.respondWithError(w, http.StatusBadRequest, "Invalid shortcode format", utils.ShortcodeRequirements())
+	}
+}
+
 // getLocationFromIP extracts a coarse-grained location from an IP address
 // In a real application, this would use a geolocation service
 func getLocationFromIP(ip string) string {
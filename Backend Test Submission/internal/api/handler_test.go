@@ -2,14 +2,22 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"12217467/backend_test_submission/internal/middleware"
 	"12217467/backend_test_submission/internal/models"
+	"12217467/backend_test_submission/internal/ratelimit"
+	"12217467/backend_test_submission/internal/reputation"
 	"12217467/backend_test_submission/internal/storage"
+	"12217467/backend_test_submission/internal/utils"
 )
 
 // Logger interface for testing
@@ -26,6 +34,13 @@ func (l *MockLogger) Info(msg string, fields map[string]interface{})  {}
 func (l *MockLogger) Error(msg string, fields map[string]interface{}) {}
 func (l *MockLogger) Debug(msg string, fields map[string]interface{}) {}
 
+// failingStore is a rate limit store whose backend is unreachable
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
 func TestCreateShortURL(t *testing.T) {
 	// Setup
 	store := storage.NewURLStore()
@@ -36,7 +51,7 @@ func TestCreateShortURL(t *testing.T) {
 	t.Run("Valid request with custom shortcode", func(t *testing.T) {
 		// Create request
 		reqBody := models.CreateShortURLRequest{
-			URL:       "https://example.com",
+			URL:       "https://example.org",
 			Validity:  intPtr(60),
 			Shortcode: "testcode",
 		}
@@ -71,7 +86,7 @@ func TestCreateShortURL(t *testing.T) {
 	t.Run("Valid request without custom shortcode", func(t *testing.T) {
 		// Create request
 		reqBody := models.CreateShortURLRequest{
-			URL:      "https://example.com",
+			URL:      "https://example.org",
 			Validity: intPtr(60),
 		}
 		jsonBody, _ := json.Marshal(reqBody)
@@ -122,11 +137,58 @@ func TestCreateShortURL(t *testing.T) {
 		}
 	})
 
+	// Test case: Unsafe destination URLs
+	t.Run("Unsafe URL", func(t *testing.T) {
+		// The test requests are addressed to example.com, so links back to
+		// it would loop
+		for _, unsafeURL := range []string{"javascript:alert(1)", "http://localhost/admin", "http://192.168.1.1/", "https://example.com/abc"} {
+			// Create request
+			jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: unsafeURL})
+			req := httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody))
+			w := httptest.NewRecorder()
+
+			// Call handler
+			handler.CreateShortURL(w, req)
+
+			// Check response
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %d, got %d", unsafeURL, http.StatusBadRequest, w.Code)
+			}
+			var resp models.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Details == "" {
+				t.Errorf("%s: expected details explaining the rejection, got %q", unsafeURL, w.Body.String())
+			}
+		}
+	})
+
+	// Test case: Reserved shortcode
+	t.Run("Reserved shortcode", func(t *testing.T) {
+		// Create request for a code that would shadow the static file route
+		reqBody := models.CreateShortURLRequest{
+			URL:       "https://example.org",
+			Shortcode: "static",
+		}
+		jsonBody, _ := json.Marshal(reqBody)
+		req := httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+
+		// Create response recorder
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.CreateShortURL(w, req)
+
+		// Check response
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status code %d, got %d", http.StatusUnprocessableEntity, w.Code)
+		}
+	})
+
 	// Test case: Duplicate shortcode
 	t.Run("Duplicate shortcode", func(t *testing.T) {
 		// First request to create the shortcode
 		reqBody := models.CreateShortURLRequest{
-			URL:       "https://example.com",
+			URL:       "https://example.org",
 			Shortcode: "duplicate",
 		}
 		jsonBody, _ := json.Marshal(reqBody)
@@ -156,6 +218,244 @@ func TestCreateShortURL(t *testing.T) {
 	})
 }
 
+func TestCreateShortURLExpiry(t *testing.T) {
+	// Setup
+	policy := ExpiryPolicy{MaxValidity: 30 * 24 * time.Hour, AllowNeverExpires: true}
+	handler := NewHandler(storage.NewURLStore(), &MockLogger{}, WithExpiryPolicy(policy))
+	inOneWeek := time.Now().Add(7 * 24 * time.Hour).Truncate(time.Second)
+	yesterday := time.Now().Add(-24 * time.Hour)
+	inOneYear := time.Now().AddDate(1, 0, 0)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantExpiry time.Duration // Expected time from now until expiry
+	}{
+		{"Default", `{}`, http.StatusCreated, DefaultValidityMinutes * time.Minute},
+		{"Minutes", `{"validity": 90}`, http.StatusCreated, 90 * time.Minute},
+		{"ISO-8601 duration", `{"validFor": "P1DT12H"}`, http.StatusCreated, 36 * time.Hour},
+		{"Absolute expiry", fmt.Sprintf(`{"expiresAt": %q}`, inOneWeek.Format(time.RFC3339)), http.StatusCreated, time.Until(inOneWeek)},
+		{"Zero validity", `{"validity": 0}`, http.StatusBadRequest, 0},
+		{"Negative validity", `{"validity": -5}`, http.StatusBadRequest, 0},
+		{"Empty duration", `{"validFor": "PT0S"}`, http.StatusBadRequest, 0},
+		{"Malformed duration", `{"validFor": "1 day"}`, http.StatusBadRequest, 0},
+		{"Expiry in the past", fmt.Sprintf(`{"expiresAt": %q}`, yesterday.Format(time.RFC3339)), http.StatusBadRequest, 0},
+		{"Beyond maximum", fmt.Sprintf(`{"expiresAt": %q}`, inOneYear.Format(time.RFC3339)), http.StatusBadRequest, 0},
+		{"Conflicting fields", `{"validity": 60, "validFor": "PT1H"}`, http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Create request
+			var body map[string]interface{}
+			json.Unmarshal([]byte(tt.body), &body)
+			body["url"] = "https://example.org"
+			jsonBody, _ := json.Marshal(body)
+			w := httptest.NewRecorder()
+
+			// Call handler
+			handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+
+			// Check response
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+			var resp models.CreateShortURLResponse
+			json.NewDecoder(w.Body).Decode(&resp)
+			if diff := time.Until(resp.Expiry) - tt.wantExpiry; diff.Abs() > 5*time.Second {
+				t.Errorf("Expected expiry in %v, got %v", tt.wantExpiry, time.Until(resp.Expiry))
+			}
+		})
+	}
+
+	// Test case: Expiries beyond what can be stored are rejected even
+	// without a maximum validity
+	t.Run("Out of range", func(t *testing.T) {
+		unbounded := NewHandler(storage.NewURLStore(), &MockLogger{})
+		for _, body := range []string{
+			`{"url": "https://example.org", "validFor": "P99999Y"}`,
+			`{"url": "https://example.org", "validFor": "PT99999999999H"}`,
+			`{"url": "https://example.org", "validity": 200000000}`,
+			fmt.Sprintf(`{"url": "https://example.org", "expiresAt": %q}`, models.NeverExpires.Format(time.RFC3339)),
+			fmt.Sprintf(`{"url": "https://example.org", "activatesAt": %q}`, models.NeverExpires.Add(-time.Minute).Format(time.RFC3339)),
+		} {
+			// Call handler
+			w := httptest.NewRecorder()
+			unbounded.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", strings.NewReader(body)))
+
+			// Check response
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status code %d for %s, got %d: %s", http.StatusBadRequest, body, w.Code, w.Body.String())
+			}
+		}
+	})
+
+	// Test case: Never-expiring links
+	t.Run("Never expires", func(t *testing.T) {
+		// Create request
+		jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org", NeverExpires: true})
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+
+		// Check response
+		var resp models.CreateShortURLResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		if w.Code != http.StatusCreated || !resp.NeverExpires || !resp.Expiry.Equal(models.NeverExpires) {
+			t.Errorf("Expected never-expiring link, got %d: %+v", w.Code, resp)
+		}
+
+		// Not allowed without the policy
+		w = httptest.NewRecorder()
+		NewHandler(storage.NewURLStore(), &MockLogger{}).CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
+
+func TestCreateShortURLCollisionRetry(t *testing.T) {
+	// Setup
+	store := storage.NewURLStore()
+	logger := &MockLogger{}
+
+	// Collide on every attempt until the requested length has grown
+	var lengths []int
+	handler := NewHandler(store, logger, WithGenerator(utils.GeneratorFunc(func(_ string, length int) (string, error) {
+		lengths = append(lengths, length)
+		if len(lengths) <= 3 {
+			return "taken", nil
+		}
+		return "free", nil
+	})))
+
+	now := time.Now()
+	store.Create(context.Background(), models.ShortURL{
+		ID:          "taken",
+		OriginalURL: "https://example.com",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(30 * time.Minute),
+	})
+
+	// Create request
+	jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org"})
+	req := httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+
+	// Call handler
+	handler.CreateShortURL(w, req)
+
+	// Check response
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+	if len(lengths) != 4 {
+		t.Fatalf("Expected 4 generation attempts, got %d", len(lengths))
+	}
+	if lengths[0] != lengths[1] || lengths[2] <= lengths[0] {
+		t.Errorf("Expected shortcode length to grow after repeated collisions, got %v", lengths)
+	}
+}
+
+func TestHashShortcodeRepeatedURL(t *testing.T) {
+	// Setup
+	handler := NewHandler(storage.NewURLStore(), &MockLogger{}, WithGenerator(utils.HashGenerator{}))
+
+	// Test case: Shortening the same URL many times keeps working
+	codes := make(map[string]bool)
+	for i := 0; i < 3*maxGenerateAttempts; i++ {
+		// Create request
+		jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org/same"})
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+
+		// Check response
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Link %d: expected status code %d, got %d: %s", i+1, http.StatusCreated, w.Code, w.Body.String())
+		}
+		var resp models.CreateShortURLResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		codes[resp.ShortLink] = true
+	}
+	if len(codes) != 3*maxGenerateAttempts {
+		t.Errorf("Expected %d distinct links, got %d", 3*maxGenerateAttempts, len(codes))
+	}
+}
+
+func TestCaseInsensitiveShortcodes(t *testing.T) {
+	// Setup
+	store := storage.NewURLStore()
+	logger := &MockLogger{}
+	handler := NewHandler(store, logger, WithCaseInsensitiveShortcodes())
+
+	// Test case: Custom shortcode is stored in lower case
+	t.Run("Create folds case", func(t *testing.T) {
+		// Create request
+		jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org", Shortcode: "Promo"})
+		req := httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody))
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.CreateShortURL(w, req)
+
+		// Check response
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+		}
+		var resp models.CreateShortURLResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if !strings.HasSuffix(resp.ShortLink, "/promo") {
+			t.Errorf("Expected short link to end with /promo, got %s", resp.ShortLink)
+		}
+	})
+
+	// Test case: Case variants of an existing shortcode conflict
+	t.Run("Case variant conflict", func(t *testing.T) {
+		// Create request
+		jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org", Shortcode: "PROMO"})
+		req := httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody))
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.CreateShortURL(w, req)
+
+		// Check response
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+		}
+	})
+
+	// Test case: Redirect and stats accept any case
+	t.Run("Lookup ignores case", func(t *testing.T) {
+		// Call handler
+		w := httptest.NewRecorder()
+		handler.RedirectURL(w, httptest.NewRequest("GET", "/pRoMo", nil))
+
+		// Check response
+		if w.Code != http.StatusFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusFound, w.Code)
+		}
+
+		// Call handler
+		w = httptest.NewRecorder()
+		handler.GetURLStats(w, httptest.NewRequest("GET", "/shorturls/PROMO", nil))
+
+		// Check response
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+	})
+}
+
 func TestGetURLStats(t *testing.T) {
 	// Setup
 	store := storage.NewURLStore()
@@ -173,7 +473,7 @@ func TestGetURLStats(t *testing.T) {
 		Clicks:      0,
 		ClickData:   []models.Click{},
 	}
-	store.Create(shortURL)
+	store.Create(context.Background(), shortURL)
 
 	// Test case: Get stats for existing shortcode
 	t.Run("Get stats for existing shortcode", func(t *testing.T) {
@@ -223,6 +523,1119 @@ func TestGetURLStats(t *testing.T) {
 	})
 }
 
+func TestUpdateShortURL(t *testing.T) {
+	// Setup
+	store := storage.NewURLStore()
+	logger := &MockLogger{}
+	handler := NewHandler(store, logger)
+
+	// Create test URLs
+	now := time.Now()
+	store.Create(context.Background(), models.ShortURL{
+		ID:          "testupdate",
+		OriginalURL: "https://example.com",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(30 * time.Minute),
+		ClickData:   []models.Click{},
+	})
+	store.Create(context.Background(), models.ShortURL{
+		ID:          "testexpired",
+		OriginalURL: "https://example.com",
+		CreatedAt:   now.Add(-time.Hour),
+		ExpiresAt:   now.Add(-time.Minute),
+		ClickData:   []models.Click{},
+	})
+
+	// Test case: Change destination and validity
+	t.Run("Valid update", func(t *testing.T) {
+		// Create request
+		newURL := "https://example.org/new"
+		jsonBody, _ := json.Marshal(models.UpdateShortURLRequest{URL: &newURL, Validity: intPtr(120)})
+		req := httptest.NewRequest("PATCH", "/shorturls/testupdate", bytes.NewBuffer(jsonBody))
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.UpdateShortURL(w, req)
+
+		// Check response
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+
+		var resp models.URLStatsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if resp.OriginalURL != newURL {
+			t.Errorf("Expected originalUrl %s, got %s", newURL, resp.OriginalURL)
+		}
+		if resp.ExpiresAt.Before(now.Add(119 * time.Minute)) {
+			t.Errorf("Expected expiry to be extended, got %v", resp.ExpiresAt)
+		}
+	})
+
+	// Test case: Invalid URL
+	t.Run("Invalid URL", func(t *testing.T) {
+		// Create request
+		jsonBody := []byte(`{"url": "invalid-url"}`)
+		req := httptest.NewRequest("PATCH", "/shorturls/testupdate", bytes.NewBuffer(jsonBody))
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.UpdateShortURL(w, req)
+
+		// Check response
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	// Test case: Non-existent and expired shortcodes
+	t.Run("Missing or expired shortcode", func(t *testing.T) {
+		for path, status := range map[string]int{
+			"/shorturls/nonexistent": http.StatusNotFound,
+			"/shorturls/testexpired": http.StatusGone,
+		} {
+			// Create request
+			req := httptest.NewRequest("PATCH", path, bytes.NewBufferString(`{"validity": 60}`))
+			w := httptest.NewRecorder()
+
+			// Call handler
+			handler.UpdateShortURL(w, req)
+
+			// Check response
+			if w.Code != status {
+				t.Errorf("%s: expected status code %d, got %d", path, status, w.Code)
+			}
+		}
+	})
+}
+
+func TestDeleteShortURL(t *testing.T) {
+	// Setup
+	store := storage.NewURLStore()
+	logger := &MockLogger{}
+	handler := NewHandler(store, logger)
+
+	// Create a test URL
+	now := time.Now()
+	store.Create(context.Background(), models.ShortURL{
+		ID:          "testdelete",
+		OriginalURL: "https://example.com",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(30 * time.Minute),
+		ClickData:   []models.Click{},
+	})
+
+	// Test case: Delete existing shortcode
+	t.Run("Delete existing shortcode", func(t *testing.T) {
+		// Call handler
+		w := httptest.NewRecorder()
+		handler.DeleteShortURL(w, httptest.NewRequest("DELETE", "/shorturls/testdelete", nil))
+
+		// Check response
+		if w.Code != http.StatusNoContent {
+			t.Errorf("Expected status code %d, got %d", http.StatusNoContent, w.Code)
+		}
+	})
+
+	// Test case: Deleted shortcodes answer 410 and cannot be claimed again
+	t.Run("Deleted shortcode", func(t *testing.T) {
+		// Call handler
+		w := httptest.NewRecorder()
+		handler.RedirectURL(w, httptest.NewRequest("GET", "/testdelete", nil))
+
+		// Check response
+		if w.Code != http.StatusGone {
+			t.Errorf("Expected status code %d, got %d", http.StatusGone, w.Code)
+		}
+
+		w = httptest.NewRecorder()
+		handler.DeleteShortURL(w, httptest.NewRequest("DELETE", "/shorturls/testdelete", nil))
+		if w.Code != http.StatusGone {
+			t.Errorf("Expected status code %d for second delete, got %d", http.StatusGone, w.Code)
+		}
+
+		jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org/takeover", Shortcode: "testdelete"})
+		w = httptest.NewRecorder()
+		handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d when reusing the shortcode, got %d", http.StatusConflict, w.Code)
+		}
+	})
+
+	// Test case: Delete non-existent shortcode
+	t.Run("Delete non-existent shortcode", func(t *testing.T) {
+		// Call handler
+		w := httptest.NewRecorder()
+		handler.DeleteShortURL(w, httptest.NewRequest("DELETE", "/shorturls/missing", nil))
+
+		// Check response
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
+func TestOwnerAuthorization(t *testing.T) {
+	// Setup
+	store := storage.NewURLStore()
+	logger := &MockLogger{}
+	handler := NewHandler(store, logger, WithAuthRequired())
+
+	asOwner := func(req *http.Request, owner string, scopes ...string) *http.Request {
+		if len(scopes) == 0 {
+			scopes = middleware.DefaultAPIKeyScopes
+		}
+		principal := middleware.Principal{ID: owner, Scopes: scopes}
+		return req.WithContext(middleware.WithPrincipal(req.Context(), principal))
+	}
+
+	// Test case: Anonymous create is rejected
+	t.Run("Anonymous create", func(t *testing.T) {
+		// Create request
+		jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org"})
+		req := httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody))
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.CreateShortURL(w, req)
+
+		// Check response
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+	})
+
+	// Test case: Create requires the create scope
+	t.Run("Create without scope", func(t *testing.T) {
+		// Create request
+		jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org"})
+		req := asOwner(httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)), "key:alice", middleware.ScopeReadStats)
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.CreateShortURL(w, req)
+
+		// Check response
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status code %d, got %d", http.StatusForbidden, w.Code)
+		}
+	})
+
+	// Test case: Create records the owner
+	t.Run("Authenticated create", func(t *testing.T) {
+		// Create request
+		jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org", Shortcode: "owned"})
+		req := asOwner(httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)), "key:alice")
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.CreateShortURL(w, req)
+
+		// Check response
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+		}
+		shortURL, _ := store.Get(context.Background(), "owned")
+		if shortURL.Owner != "key:alice" {
+			t.Errorf("Expected owner key:alice, got %q", shortURL.Owner)
+		}
+	})
+
+	// Test case: Only the owner can read stats, update and delete
+	t.Run("Owner checks", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			req    *http.Request
+			status int
+		}{
+			{"Anonymous stats", httptest.NewRequest("GET", "/shorturls/owned", nil), http.StatusUnauthorized},
+			{"Other owner's stats", asOwner(httptest.NewRequest("GET", "/shorturls/owned", nil), "key:bob"), http.StatusForbidden},
+			{"Other owner's update", asOwner(httptest.NewRequest("PATCH", "/shorturls/owned", bytes.NewBufferString(`{"validity": 60}`)), "key:bob"), http.StatusForbidden},
+			{"Other owner's delete", asOwner(httptest.NewRequest("DELETE", "/shorturls/owned", nil), "key:bob"), http.StatusForbidden},
+			{"Token subject with the key owner's name", asOwner(httptest.NewRequest("GET", "/shorturls/owned", nil), "jwt:alice"), http.StatusForbidden},
+			{"Token subject's delete", asOwner(httptest.NewRequest("DELETE", "/shorturls/owned", nil), "jwt:alice"), http.StatusForbidden},
+			{"Stats without scope", asOwner(httptest.NewRequest("GET", "/shorturls/owned", nil), "key:alice", middleware.ScopeCreate), http.StatusForbidden},
+			{"Admin's stats", asOwner(httptest.NewRequest("GET", "/shorturls/owned", nil), "key:root", middleware.ScopeAdmin), http.StatusOK},
+			{"Owner's stats", asOwner(httptest.NewRequest("GET", "/shorturls/owned", nil), "key:alice"), http.StatusOK},
+			{"Owner's update", asOwner(httptest.NewRequest("PATCH", "/shorturls/owned", bytes.NewBufferString(`{"validity": 60}`)), "key:alice"), http.StatusOK},
+			{"Owner's delete", asOwner(httptest.NewRequest("DELETE", "/shorturls/owned", nil), "key:alice"), http.StatusNoContent},
+		}
+
+		for _, tt := range tests {
+			// Call handler
+			w := httptest.NewRecorder()
+			switch tt.req.Method {
+			case "GET":
+				handler.GetURLStats(w, tt.req)
+			case "PATCH":
+				handler.UpdateShortURL(w, tt.req)
+			case "DELETE":
+				handler.DeleteShortURL(w, tt.req)
+			}
+
+			// Check response
+			if w.Code != tt.status {
+				t.Errorf("%s: expected status code %d, got %d", tt.name, tt.status, w.Code)
+			}
+		}
+	})
+
+	// Test case: Owners recorded without a source prefix belong to API keys
+	t.Run("Unprefixed owner", func(t *testing.T) {
+		now := time.Now()
+		store.Create(context.Background(), models.ShortURL{ID: "legacy", OriginalURL: "https://example.org", CreatedAt: now, ExpiresAt: now.Add(time.Hour), Owner: "alice"})
+
+		for owner, status := range map[string]int{"jwt:alice": http.StatusForbidden, "key:alice": http.StatusOK} {
+			// Call handler
+			w := httptest.NewRecorder()
+			handler.GetURLStats(w, asOwner(httptest.NewRequest("GET", "/shorturls/legacy", nil), owner))
+
+			// Check response
+			if w.Code != status {
+				t.Errorf("%s: expected status code %d, got %d", owner, status, w.Code)
+			}
+		}
+	})
+}
+
+func TestReputationChecks(t *testing.T) {
+	// Setup
+	pages, err := LoadPages("../../static")
+	if err != nil {
+		t.Fatalf("Failed to load pages: %v", err)
+	}
+	checker := reputation.CheckerFunc(func(ctx context.Context, rawURL string) (reputation.Verdict, error) {
+		if strings.Contains(rawURL, "phish.example") {
+			return reputation.Verdict{Malicious: true, Threat: "SOCIAL_ENGINEERING", Source: "test"}, nil
+		}
+		return reputation.Verdict{}, nil
+	})
+
+	create := func(handler *Handler, destination string) int {
+		jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: destination, Shortcode: "flagged"})
+		w := httptest.NewRecorder()
+		handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+		return w.Code
+	}
+
+	// Test case: Reject mode refuses flagged destinations
+	t.Run("Reject", func(t *testing.T) {
+		handler := NewHandler(storage.NewURLStore(), &MockLogger{}, WithURLChecker(checker, reputation.ActionReject))
+
+		if code := create(handler, "https://phish.example/login"); code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status code %d, got %d", http.StatusUnprocessableEntity, code)
+		}
+		if code := create(handler, "https://example.org/"); code != http.StatusCreated {
+			t.Errorf("Expected status code %d, got %d", http.StatusCreated, code)
+		}
+	})
+
+	// Test case: Warn mode shows an interstitial before redirecting
+	t.Run("Interstitial", func(t *testing.T) {
+		handler := NewHandler(storage.NewURLStore(), &MockLogger{}, WithURLChecker(checker, reputation.ActionWarn), WithPages(pages))
+
+		if code := create(handler, "https://phish.example/login"); code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d", http.StatusCreated, code)
+		}
+
+		// Call handler
+		w := httptest.NewRecorder()
+		handler.RedirectURL(w, httptest.NewRequest("GET", "/flagged", nil))
+
+		// Check response
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "https://phish.example/login") {
+			t.Errorf("Expected warning page, got %d: %s", w.Code, w.Body.String())
+		}
+
+		// Call handler
+		w = httptest.NewRecorder()
+		handler.RedirectURL(w, httptest.NewRequest("GET", "/flagged?proceed=1", nil))
+
+		// Check response
+		if w.Code != http.StatusFound {
+			t.Errorf("Expected status code %d after confirming, got %d", http.StatusFound, w.Code)
+		}
+	})
+
+	// Test case: A replica without the verdict cached still checks the
+	// destination before redirecting
+	t.Run("Cache miss", func(t *testing.T) {
+		store := storage.NewURLStore()
+		creator := NewHandler(store, &MockLogger{}, WithURLChecker(reputation.NewCachingChecker(checker, time.Hour), reputation.ActionWarn), WithPages(pages))
+		if code := create(creator, "https://phish.example/login"); code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d", http.StatusCreated, code)
+		}
+
+		for _, action := range []reputation.Action{reputation.ActionWarn, reputation.ActionReject} {
+			replica := NewHandler(store, &MockLogger{}, WithURLChecker(reputation.NewCachingChecker(checker, time.Hour), action), WithPages(pages))
+
+			// Call handler
+			w := httptest.NewRecorder()
+			replica.RedirectURL(w, httptest.NewRequest("GET", "/flagged", nil))
+
+			// Check response
+			if w.Code == http.StatusFound {
+				t.Errorf("Expected %s mode to stop the first redirect, got %d to %s", action, w.Code, w.Header().Get("Location"))
+			}
+		}
+	})
+}
+
+func TestRedirectTypes(t *testing.T) {
+	// Setup
+	store := storage.NewURLStore()
+	handler := NewHandler(store, &MockLogger{})
+
+	launched := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name         string
+		redirectType int
+		wantStatus   int
+		wantCache    string
+		maxClicks    int
+		activatesAt  *time.Time
+		fallbackURL  string
+	}{
+		{"Default", 0, http.StatusFound, "private, no-store", 0, nil, ""},
+		{"Moved permanently", http.StatusMovedPermanently, http.StatusMovedPermanently, "public, max-age=", 0, nil, ""},
+		{"Temporary redirect", http.StatusTemporaryRedirect, http.StatusTemporaryRedirect, "private, no-store", 0, nil, ""},
+		{"Permanent redirect", http.StatusPermanentRedirect, http.StatusPermanentRedirect, "public, max-age=", 0, nil, ""},
+		{"Permanent with click limit", http.StatusPermanentRedirect, http.StatusPermanentRedirect, "private, no-store", 5, nil, ""},
+		{"Permanent and scheduled", http.StatusPermanentRedirect, http.StatusPermanentRedirect, "private, no-store", 0, &launched, ""},
+		{"Permanent with fallback", http.StatusPermanentRedirect, http.StatusPermanentRedirect, "private, no-store", 0, nil, "https://example.org/offers"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shortcode := fmt.Sprintf("type%d", i)
+
+			// Create request
+			jsonBody, _ := json.Marshal(models.CreateShortURLRequest{
+				URL:          "https://example.org",
+				Shortcode:    shortcode,
+				RedirectType: tt.redirectType,
+				MaxClicks:    tt.maxClicks,
+				ActivatesAt:  tt.activatesAt,
+				FallbackURL:  tt.fallbackURL,
+			})
+			w := httptest.NewRecorder()
+			handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+			if w.Code != http.StatusCreated {
+				t.Fatalf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+			}
+
+			// Call handler
+			w = httptest.NewRecorder()
+			handler.RedirectURL(w, httptest.NewRequest("GET", "/"+shortcode, nil))
+
+			// Check response
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, w.Code)
+			}
+			if cache := w.Header().Get("Cache-Control"); !strings.HasPrefix(cache, tt.wantCache) {
+				t.Errorf("Expected Cache-Control %q, got %q", tt.wantCache, cache)
+			}
+
+			// Check stats
+			w = httptest.NewRecorder()
+			handler.GetURLStats(w, httptest.NewRequest("GET", "/shorturls/"+shortcode, nil))
+			var stats models.URLStatsResponse
+			json.NewDecoder(w.Body).Decode(&stats)
+			if stats.RedirectType != tt.wantStatus {
+				t.Errorf("Expected redirectType %d in stats, got %d", tt.wantStatus, stats.RedirectType)
+			}
+		})
+	}
+
+	// Test case: Unsupported redirect type
+	t.Run("Unsupported redirect type", func(t *testing.T) {
+		// Create request
+		jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org", RedirectType: http.StatusSeeOther})
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+
+		// Check response
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	// Test case: Updating the redirect type
+	t.Run("Update redirect type", func(t *testing.T) {
+		// Create request
+		jsonBody, _ := json.Marshal(map[string]int{"redirectType": http.StatusMovedPermanently})
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.UpdateShortURL(w, httptest.NewRequest("PATCH", "/shorturls/type0", bytes.NewBuffer(jsonBody)))
+
+		// Check response
+		var stats models.URLStatsResponse
+		json.NewDecoder(w.Body).Decode(&stats)
+		if w.Code != http.StatusOK || stats.RedirectType != http.StatusMovedPermanently {
+			t.Errorf("Expected redirectType %d, got status %d and %d", http.StatusMovedPermanently, w.Code, stats.RedirectType)
+		}
+	})
+}
+
+func TestClickLimit(t *testing.T) {
+	// Setup
+	store := storage.NewURLStore()
+	handler := NewHandler(store, &MockLogger{})
+
+	jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org", Shortcode: "twice", MaxClicks: 2})
+	w := httptest.NewRecorder()
+	handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	// Test case: Redirects stop once the limit is reached
+	t.Run("Limit reached", func(t *testing.T) {
+		for i, want := range []int{http.StatusFound, http.StatusFound, http.StatusGone} {
+			// Call handler
+			w := httptest.NewRecorder()
+			handler.RedirectURL(w, httptest.NewRequest("GET", "/twice", nil))
+
+			// Check response
+			if w.Code != want {
+				t.Errorf("Click %d: expected status code %d, got %d", i+1, want, w.Code)
+			}
+			if want == http.StatusGone {
+				var errResp models.ErrorResponse
+				json.NewDecoder(w.Body).Decode(&errResp)
+				if errResp.Error != "Click limit reached" {
+					t.Errorf("Expected click limit error, got %q", errResp.Error)
+				}
+			}
+		}
+
+		// Clicks of limited links are recorded before redirecting
+		shortURL, _ := store.Get(context.Background(), "twice")
+		if shortURL.Clicks != 2 {
+			t.Errorf("Expected 2 clicks, got %d", shortURL.Clicks)
+		}
+	})
+
+	// Test case: Negative limit
+	t.Run("Negative limit", func(t *testing.T) {
+		// Create request
+		jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org", MaxClicks: -1})
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+
+		// Check response
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
+
+func TestScheduledActivation(t *testing.T) {
+	// Setup
+	store := storage.NewURLStore()
+	activatesAt := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+
+	create := func(handler *Handler, shortcode string) {
+		jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org", Shortcode: shortcode, ActivatesAt: &activatesAt})
+		w := httptest.NewRecorder()
+		handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+		}
+	}
+
+	// Test case: Redirects answer 425 until launch
+	t.Run("Too early", func(t *testing.T) {
+		handler := NewHandler(store, &MockLogger{})
+		create(handler, "launch")
+
+		// Call handler
+		w := httptest.NewRecorder()
+		handler.RedirectURL(w, httptest.NewRequest("GET", "/launch", nil))
+
+		// Check response
+		if w.Code != http.StatusTooEarly {
+			t.Errorf("Expected status code %d, got %d", http.StatusTooEarly, w.Code)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Error("Expected Retry-After header")
+		}
+	})
+
+	// Test case: Stats show the schedule, with validity counted from launch
+	t.Run("Stats", func(t *testing.T) {
+		handler := NewHandler(store, &MockLogger{})
+
+		// Call handler
+		w := httptest.NewRecorder()
+		handler.GetURLStats(w, httptest.NewRequest("GET", "/shorturls/launch", nil))
+
+		// Check response
+		var stats models.URLStatsResponse
+		json.NewDecoder(w.Body).Decode(&stats)
+		if w.Code != http.StatusOK || stats.ActivatesAt == nil || !stats.ActivatesAt.Equal(activatesAt) {
+			t.Fatalf("Expected schedule in stats, got %d: %+v", w.Code, stats)
+		}
+		if want := activatesAt.Add(DefaultValidityMinutes * time.Minute); !stats.ExpiresAt.Equal(want) {
+			t.Errorf("Expected expiry %v, got %v", want, stats.ExpiresAt)
+		}
+	})
+
+	// Test case: Not active links can be hidden behind 404
+	t.Run("Not found", func(t *testing.T) {
+		handler := NewHandler(store, &MockLogger{}, WithNotActiveStatus(http.StatusNotFound))
+
+		// Call handler
+		w := httptest.NewRecorder()
+		handler.RedirectURL(w, httptest.NewRequest("GET", "/launch", nil))
+
+		// Check response
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+
+	// Test case: Moving the launch into the past activates the link
+	t.Run("Activate now", func(t *testing.T) {
+		handler := NewHandler(store, &MockLogger{})
+
+		// Create request
+		jsonBody, _ := json.Marshal(map[string]time.Time{"activatesAt": time.Now().Add(-time.Minute)})
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.UpdateShortURL(w, httptest.NewRequest("PATCH", "/shorturls/launch", bytes.NewBuffer(jsonBody)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+
+		// Check response
+		w = httptest.NewRecorder()
+		handler.RedirectURL(w, httptest.NewRequest("GET", "/launch", nil))
+		if w.Code != http.StatusFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusFound, w.Code)
+		}
+	})
+
+	// Test case: Launch after expiry
+	t.Run("Launch after expiry", func(t *testing.T) {
+		handler := NewHandler(store, &MockLogger{})
+
+		// Create request
+		jsonBody, _ := json.Marshal(map[string]time.Time{"activatesAt": time.Now().Add(365 * 24 * time.Hour)})
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.UpdateShortURL(w, httptest.NewRequest("PATCH", "/shorturls/launch", bytes.NewBuffer(jsonBody)))
+
+		// Check response
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	// Test case: Moving the launch earlier cannot stretch the validity
+	// beyond the maximum
+	t.Run("Maximum validity", func(t *testing.T) {
+		handler := NewHandler(store, &MockLogger{}, WithExpiryPolicy(ExpiryPolicy{MaxValidity: 36 * time.Hour}))
+		jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org", Shortcode: "capped", ActivatesAt: &activatesAt, ValidFor: "P1D"})
+		w := httptest.NewRecorder()
+		handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+		}
+
+		for _, tt := range []struct {
+			activatesAt time.Time
+			wantStatus  int
+		}{
+			{time.Now().Add(-time.Minute), http.StatusBadRequest},
+			{time.Now().Add(20 * time.Hour), http.StatusOK},
+		} {
+			// Create request
+			jsonBody, _ := json.Marshal(map[string]time.Time{"activatesAt": tt.activatesAt})
+			w := httptest.NewRecorder()
+
+			// Call handler
+			handler.UpdateShortURL(w, httptest.NewRequest("PATCH", "/shorturls/capped", bytes.NewBuffer(jsonBody)))
+
+			// Check response
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d for activation at %v, got %d: %s", tt.wantStatus, tt.activatesAt, w.Code, w.Body.String())
+			}
+		}
+	})
+}
+
+func TestPreviewPage(t *testing.T) {
+	// Setup
+	pages, err := LoadPages("../../static")
+	if err != nil {
+		t.Fatalf("Failed to load pages: %v", err)
+	}
+	store := storage.NewURLStore()
+	handler := NewHandler(store, &MockLogger{}, WithPages(pages))
+
+	now := time.Now()
+	store.Create(context.Background(), models.ShortURL{
+		ID:          "plain",
+		OriginalURL: "https://example.org/plain",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(30 * time.Minute),
+		ClickData:   []models.Click{},
+	})
+	store.Create(context.Background(), models.ShortURL{
+		ID:          "previewed",
+		OriginalURL: "https://example.org/previewed",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(30 * time.Minute),
+		ClickData:   []models.Click{},
+		Preview:     true,
+	})
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"Plus suffix shows preview", "/plain+", http.StatusOK, "https://example.org/plain"},
+		{"Plain link redirects", "/plain", http.StatusFound, ""},
+		{"Preview link shows preview", "/previewed", http.StatusOK, "https://example.org/previewed"},
+		{"Proceed skips preview", "/previewed?proceed=1", http.StatusFound, ""},
+		{"Unknown link with plus suffix", "/missing+", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Call handler
+			w := httptest.NewRecorder()
+			handler.RedirectURL(w, httptest.NewRequest("GET", tt.path, nil))
+
+			// Check response
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantBody != "" && !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("Expected preview page to mention %s, got %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+
+	// Test case: Viewing a preview does not count as a click
+	t.Run("Preview is not a click", func(t *testing.T) {
+		shortURL, err := store.Get(context.Background(), "previewed")
+		if err != nil {
+			t.Fatalf("Failed to get URL: %v", err)
+		}
+		// Only the proceed request above redirected
+		if shortURL.Clicks > 1 {
+			t.Errorf("Expected at most 1 click, got %d", shortURL.Clicks)
+		}
+	})
+}
+
+func TestPasswordProtection(t *testing.T) {
+	// Setup
+	pages, err := LoadPages("../../static")
+	if err != nil {
+		t.Fatalf("Failed to load pages: %v", err)
+	}
+	limit := ratelimit.Limit{Requests: 2, Per: time.Hour}
+	handler := NewHandler(storage.NewURLStore(), &MockLogger{}, WithPages(pages), WithPasswordThrottle(ratelimit.NewMemoryStore(), limit))
+
+	jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org/internal", Shortcode: "secret", Password: "hunter2"})
+	w := httptest.NewRecorder()
+	handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	unlock := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/secret", strings.NewReader("password="+password))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.UnlockURL(w, req)
+		return w
+	}
+
+	// Test case: The password form hides the destination
+	t.Run("Password form", func(t *testing.T) {
+		// Call handler
+		w := httptest.NewRecorder()
+		handler.RedirectURL(w, httptest.NewRequest("GET", "/secret", nil))
+
+		// Check response
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+		if body := w.Body.String(); !strings.Contains(body, `name="password"`) || strings.Contains(body, "example.org") {
+			t.Errorf("Expected password form without the destination, got %s", body)
+		}
+	})
+
+	// Test case: Wrong password
+	t.Run("Wrong password", func(t *testing.T) {
+		w := unlock("wrong")
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Error("Expected no unlock cookie")
+		}
+	})
+
+	// Test case: Correct password unlocks the link
+	t.Run("Correct password", func(t *testing.T) {
+		w := unlock("hunter2")
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("Expected status code %d, got %d", http.StatusSeeOther, w.Code)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("Expected an unlock cookie, got %d cookies", len(cookies))
+		}
+
+		// Call handler with the cookie
+		req := httptest.NewRequest("GET", "/secret", nil)
+		req.AddCookie(cookies[0])
+		w = httptest.NewRecorder()
+		handler.RedirectURL(w, req)
+		if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.org/internal" {
+			t.Errorf("Expected redirect, got %d to %q", w.Code, w.Header().Get("Location"))
+		}
+
+		// A forged cookie does not unlock the link
+		req = httptest.NewRequest("GET", "/secret", nil)
+		req.AddCookie(&http.Cookie{Name: cookies[0].Name, Value: "9999999999.forged"})
+		w = httptest.NewRecorder()
+		handler.RedirectURL(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code %d for forged cookie, got %d", http.StatusUnauthorized, w.Code)
+		}
+	})
+
+	// Test case: Unlocked permanent redirects are never cached
+	t.Run("Permanent redirect", func(t *testing.T) {
+		jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org/internal", Shortcode: "secret308", Password: "hunter2", RedirectType: http.StatusPermanentRedirect})
+		w := httptest.NewRecorder()
+		handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d", http.StatusCreated, w.Code)
+		}
+
+		req := httptest.NewRequest("POST", "/secret308", strings.NewReader("password=hunter2"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w = httptest.NewRecorder()
+		handler.UnlockURL(w, req)
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("Expected an unlock cookie, got %d cookies", len(cookies))
+		}
+
+		// Call handler with the cookie
+		req = httptest.NewRequest("GET", "/secret308", nil)
+		req.AddCookie(cookies[0])
+		w = httptest.NewRecorder()
+		handler.RedirectURL(w, req)
+
+		// Check response
+		if w.Code != http.StatusPermanentRedirect {
+			t.Fatalf("Expected status code %d, got %d", http.StatusPermanentRedirect, w.Code)
+		}
+		if cache := w.Header().Get("Cache-Control"); cache != "private, no-store" {
+			t.Errorf("Expected Cache-Control %q, got %q", "private, no-store", cache)
+		}
+	})
+
+	// Test case: Attempts are throttled
+	t.Run("Throttling", func(t *testing.T) {
+		w := unlock("hunter2")
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected status code %d, got %d", http.StatusTooManyRequests, w.Code)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Error("Expected Retry-After header")
+		}
+	})
+
+	// Test case: Passwords are not checked when the throttle is unavailable
+	t.Run("Throttle unavailable", func(t *testing.T) {
+		handler := NewHandler(handler.store, &MockLogger{}, WithPages(pages), WithPasswordThrottle(failingStore{}, limit))
+
+		// Create request
+		req := httptest.NewRequest("POST", "/secret", strings.NewReader("password=hunter2"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.UnlockURL(w, req)
+
+		// Check response
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Error("Expected no unlock cookie")
+		}
+	})
+
+	// Test case: Stats report the protection but not the hash
+	t.Run("Stats", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.GetURLStats(w, httptest.NewRequest("GET", "/shorturls/secret", nil))
+		if !strings.Contains(w.Body.String(), `"passwordProtected":true`) || strings.Contains(w.Body.String(), "$2a$") {
+			t.Errorf("Unexpected stats response: %s", w.Body.String())
+		}
+	})
+}
+
+func TestRedirectRules(t *testing.T) {
+	// Setup
+	store := storage.NewURLStore()
+	handler := NewHandler(store, &MockLogger{})
+
+	iPhone := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"
+	android := "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36"
+	desktop := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	crawler := "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+
+	isBot := true
+	jsonBody, _ := json.Marshal(models.CreateShortURLRequest{
+		URL:       "https://example.org/app",
+		Shortcode: "getapp",
+		RedirectRules: []models.RedirectRule{
+			{Bot: &isBot, URL: "https://example.org/app"},
+			{OS: "ios", URL: "https://apps.example.org/app/id123"},
+			{OS: "android", URL: "https://play.example.org/store/apps/details?id=org.example"},
+		},
+	})
+	w := httptest.NewRecorder()
+	handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name      string
+		userAgent string
+		location  string
+	}{
+		{"iOS", iPhone, "https://apps.example.org/app/id123"},
+		{"Android", android, "https://play.example.org/store/apps/details?id=org.example"},
+		{"Desktop", desktop, "https://example.org/app"},
+		{"Bot", crawler, "https://example.org/app"},
+		{"No user agent", "", "https://example.org/app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Create request
+			req := httptest.NewRequest("GET", "/getapp", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			w := httptest.NewRecorder()
+
+			// Call handler
+			handler.RedirectURL(w, req)
+
+			// Check response
+			if w.Code != http.StatusFound {
+				t.Fatalf("Expected status code %d, got %d", http.StatusFound, w.Code)
+			}
+			if location := w.Header().Get("Location"); location != tt.location {
+				t.Errorf("Expected location %s, got %s", tt.location, location)
+			}
+			if vary := w.Header().Get("Vary"); vary != "User-Agent" {
+				t.Errorf("Expected Vary: User-Agent, got %q", vary)
+			}
+		})
+	}
+
+	// Test case: Clicks record the rule that matched
+	t.Run("Matched rule recorded", func(t *testing.T) {
+		// Clicks are recorded in the background
+		var clicks []models.Click
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if clicks, _ = store.ListClicks(context.Background(), "getapp"); len(clicks) == len(tests) {
+				break
+			}
+		}
+		if len(clicks) != len(tests) {
+			t.Fatalf("Expected %d clicks, got %d", len(tests), len(clicks))
+		}
+
+		matched := make(map[string]string)
+		for _, click := range clicks {
+			rule := "none"
+			if click.MatchedRule != nil {
+				rule = fmt.Sprint(*click.MatchedRule)
+			}
+			matched[click.UserAgent] = rule
+		}
+		for userAgent, want := range map[string]string{iPhone: "1", android: "2", desktop: "none", crawler: "0"} {
+			if matched[userAgent] != want {
+				t.Errorf("Expected rule %s for %q, got %s", want, userAgent, matched[userAgent])
+			}
+		}
+	})
+
+	// Test case: Invalid rules
+	t.Run("Invalid rules", func(t *testing.T) {
+		for _, rules := range [][]models.RedirectRule{
+			{{URL: "https://example.org"}},
+			{{OS: "symbian", URL: "https://example.org"}},
+			{{Device: "watch", URL: "https://example.org"}},
+			{{OS: "ios", URL: "not a url"}},
+		} {
+			// Create request
+			jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org", RedirectRules: rules})
+			w := httptest.NewRecorder()
+
+			// Call handler
+			handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+
+			// Check response
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status code %d for %+v, got %d", http.StatusBadRequest, rules, w.Code)
+			}
+		}
+	})
+
+	// Test case: Removing the rules on update
+	t.Run("Remove rules", func(t *testing.T) {
+		// Create request
+		jsonBody, _ := json.Marshal(models.UpdateShortURLRequest{RedirectRules: &[]models.RedirectRule{}})
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.UpdateShortURL(w, httptest.NewRequest("PATCH", "/shorturls/getapp", bytes.NewBuffer(jsonBody)))
+
+		// Check response
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		req := httptest.NewRequest("GET", "/getapp", nil)
+		req.Header.Set("User-Agent", iPhone)
+		w = httptest.NewRecorder()
+		handler.RedirectURL(w, req)
+		if location := w.Header().Get("Location"); location != "https://example.org/app" {
+			t.Errorf("Expected the original URL once rules are removed, got %s", location)
+		}
+	})
+}
+
+func TestExpiredFallback(t *testing.T) {
+	// Setup
+	store := storage.NewURLStore()
+	pages, err := LoadPages("../../static")
+	if err != nil {
+		t.Fatalf("Failed to load pages: %v", err)
+	}
+	handler := NewHandler(store, &MockLogger{}, WithPages(pages))
+	withDefault := NewHandler(store, &MockLogger{}, WithPages(pages), WithDefaultFallbackURL("https://example.org/default"))
+
+	now := time.Now()
+	for _, shortURL := range []models.ShortURL{
+		{ID: "oldcampaign", OriginalURL: "https://example.org/sale", CreatedAt: now, ExpiresAt: now.Add(-time.Minute), FallbackURL: "https://example.org/offers"},
+		{ID: "oldlink", OriginalURL: "https://example.org/sale", CreatedAt: now, ExpiresAt: now.Add(-time.Minute)},
+		{ID: "usedup", OriginalURL: "https://example.org/sale", CreatedAt: now, ExpiresAt: now.Add(time.Hour), MaxClicks: 1, Clicks: 1, FallbackURL: "https://example.org/offers"},
+	} {
+		store.Create(context.Background(), shortURL)
+	}
+	store.RecordClick(context.Background(), "usedup", models.Click{})
+
+	browserAccept := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+	tests := []struct {
+		name     string
+		handler  *Handler
+		path     string
+		accept   string
+		status   int
+		location string
+		html     bool
+	}{
+		{"Link fallback", handler, "/oldcampaign", "", http.StatusFound, "https://example.org/offers", false},
+		{"Link fallback over default", withDefault, "/oldcampaign", "", http.StatusFound, "https://example.org/offers", false},
+		{"Default fallback", withDefault, "/oldlink", "", http.StatusFound, "https://example.org/default", false},
+		{"Click limit fallback", handler, "/usedup", "", http.StatusFound, "https://example.org/offers", false},
+		{"Browser without fallback", handler, "/oldlink", browserAccept, http.StatusGone, "", true},
+		{"API client without fallback", handler, "/oldlink", "application/json", http.StatusGone, "", false},
+		{"Wildcard without fallback", handler, "/oldlink", "*/*", http.StatusGone, "", false},
+		{"Unknown shortcode", withDefault, "/missing", browserAccept, http.StatusNotFound, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Create request
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			// Call handler
+			tt.handler.RedirectURL(w, req)
+
+			// Check response
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, got %d", tt.status, w.Code)
+			}
+			if location := w.Header().Get("Location"); location != tt.location {
+				t.Errorf("Expected location %q, got %q", tt.location, location)
+			}
+			isHTML := strings.HasPrefix(w.Header().Get("Content-Type"), "text/html")
+			if tt.location == "" && isHTML != tt.html {
+				t.Errorf("Expected HTML response %v, got content type %q", tt.html, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	// Test case: Fallback URLs are validated like destinations
+	t.Run("Invalid fallback URL", func(t *testing.T) {
+		// Create request
+		jsonBody, _ := json.Marshal(models.CreateShortURLRequest{URL: "https://example.org", FallbackURL: "not a url"})
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.CreateShortURL(w, httptest.NewRequest("POST", "/shorturls", bytes.NewBuffer(jsonBody)))
+
+		// Check response
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	// Test case: Removing the fallback on update
+	t.Run("Update fallback URL", func(t *testing.T) {
+		store.Create(context.Background(), models.ShortURL{ID: "live", OriginalURL: "https://example.org", CreatedAt: now, ExpiresAt: now.Add(time.Hour), FallbackURL: "https://example.org/offers"})
+
+		// Create request
+		empty := ""
+		jsonBody, _ := json.Marshal(models.UpdateShortURLRequest{FallbackURL: &empty})
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.UpdateShortURL(w, httptest.NewRequest("PATCH", "/shorturls/live", bytes.NewBuffer(jsonBody)))
+
+		// Check response
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		shortURL, _ := store.Get(context.Background(), "live")
+		if shortURL.FallbackURL != "" {
+			t.Errorf("Expected fallback URL to be removed, got %q", shortURL.FallbackURL)
+		}
+	})
+}
+
 func TestRedirectURL(t *testing.T) {
 	// Setup
 	store := storage.NewURLStore()
@@ -240,7 +1653,7 @@ func TestRedirectURL(t *testing.T) {
 		Clicks:      0,
 		ClickData:   []models.Click{},
 	}
-	store.Create(shortURL)
+	store.Create(context.Background(), shortURL)
 
 	// Test case: Redirect for existing shortcode
 	t.Run("Redirect for existing shortcode", func(t *testing.T) {
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+)
+
+// Names of the HTML pages rendered by the handler
+const (
+	// warningPage is shown before redirecting to a flagged destination
+	warningPage = "warning.html"
+
+	// previewPage shows where a short link leads before redirecting
+	previewPage = "preview.html"
+
+	// passwordPage asks for the password of a protected link
+	passwordPage = "password.html"
+
+	// expiredPage tells browsers that a link no longer works
+	expiredPage = "expired.html"
+)
+
+// pageFiles lists the page templates read by LoadPages
+var pageFiles = []string{warningPage, previewPage, passwordPage, expiredPage}
+
+// LoadPages parses the HTML page templates kept in dir, normally the static
+// directory next to index.html
+func LoadPages(dir string) (*template.Template, error) {
+	paths := make([]string, len(pageFiles))
+	for i, name := range pageFiles {
+		paths[i] = filepath.Join(dir, name)
+	}
+
+	pages, err := template.ParseFiles(paths...)
+	if err != nil {
+		return nil, fmt.Errorf("parse page templates: %w", err)
+	}
+	return pages, nil
+}
+
+// WithPages sets the HTML page templates loaded by LoadPages. Without them,
+// warnings, password prompts and expired-link pages are replaced by JSON
+// error responses and previews are skipped.
+func WithPages(pages *template.Template) Option {
+	return func(h *Handler) {
+		h.pages = pages
+	}
+}
+
+// renderPage renders the named page template with data
+func (h *Handler) renderPage(w http.ResponseWriter, status int, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := h.pages.ExecuteTemplate(w, name, data); err != nil {
+		h.logger.Error("Failed to render page", map[string]interface{}{
+			"page":  name,
+			"error": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"12217467/backend_test_submission/internal/models"
+	"12217467/backend_test_submission/internal/useragent"
+)
+
+// maxRedirectRules caps how many redirect rules a link may have
+const maxRedirectRules = 20
+
+// validateRedirectRules checks requested redirect rules, responding with an
+// error for rules without conditions, unknown values and destinations that
+// cannot be used
+func (h *Handler) validateRedirectRules(w http.ResponseWriter, r *http.Request, rules []models.RedirectRule) bool {
+	if len(rules) > maxRedirectRules {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid redirect rules", fmt.Sprintf("A link may have at most %d rules", maxRedirectRules))
+		return false
+	}
+
+	for i, rule := range rules {
+		switch {
+		case rule.OS == "" && rule.Device == "" && rule.Bot == nil:
+			h.respondWithError(w, http.StatusBadRequest, "Invalid redirect rules", fmt.Sprintf("Rule %d must set os, device or bot", i+1))
+			return false
+		case rule.OS != "" && !useragent.KnownOS(rule.OS):
+			h.respondWithError(w, http.StatusBadRequest, "Invalid redirect rules",
+				fmt.Sprintf("Rule %d: os must be one of ios, android, windows, macos, linux and chromeos", i+1))
+			return false
+		case rule.Device != "" && !useragent.KnownDevice(rule.Device):
+			h.respondWithError(w, http.StatusBadRequest, "Invalid redirect rules",
+				fmt.Sprintf("Rule %d: device must be one of mobile, tablet and desktop", i+1))
+			return false
+		}
+		if !h.validateURL(w, r, rule.URL) {
+			return false
+		}
+	}
+	return true
+}
+
+// destination returns where the client making r is sent by shortURL: the
+// URL of the first redirect rule it matches, whose index is also returned,
+// or else the original URL
+func destination(r *http.Request, shortURL models.ShortURL) (string, *int) {
+	if len(shortURL.RedirectRules) == 0 {
+		return shortURL.OriginalURL, nil
+	}
+
+	client := useragent.Parse(r.UserAgent())
+	for i, rule := range shortURL.RedirectRules {
+		if ruleMatches(rule, client) {
+			return rule.URL, &i
+		}
+	}
+	return shortURL.OriginalURL, nil
+}
+
+// ruleMatches reports whether client meets every condition rule sets
+func ruleMatches(rule models.RedirectRule, client useragent.Info) bool {
+	if rule.OS != "" && rule.OS != client.OS {
+		return false
+	}
+	if rule.Device != "" && rule.Device != client.Device {
+		return false
+	}
+	if rule.Bot != nil && *rule.Bot != client.Bot {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"12217467/backend_test_submission/internal/models"
+	"12217467/backend_test_submission/internal/ratelimit"
+	"12217467/backend_test_submission/internal/storage"
+)
+
+const (
+	// unlockCookiePrefix is followed by the shortcode to name the cookie
+	// that remembers an unlocked link
+	unlockCookiePrefix = "unlock_"
+
+	// unlockLifetime is how long a correct password unlocks a link
+	unlockLifetime = 12 * time.Hour
+)
+
+// DefaultPasswordAttemptLimit is how many password attempts a client may
+// make per link
+var DefaultPasswordAttemptLimit = ratelimit.Limit{Requests: 5, Per: 15 * time.Minute}
+
+// WithPasswordThrottle limits password attempts per link and client to
+// limit, keeping the counts in store. Replicas sharing a store enforce one
+// combined limit.
+func WithPasswordThrottle(store ratelimit.Store, limit ratelimit.Limit) Option {
+	return func(h *Handler) {
+		h.passwordAttempts = store
+		h.passwordAttemptLimit = limit
+	}
+}
+
+// WithCookieSecret sets the key that signs unlock cookies. Replicas must
+// share it; without it a random key is used, and visitors are asked for the
+// password again after a restart.
+func WithCookieSecret(secret []byte) Option {
+	return func(h *Handler) {
+		h.cookieSecret = secret
+	}
+}
+
+// randomCookieSecret returns a key for unlock cookies that lasts as long as
+// the process
+func randomCookieSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic("generate cookie secret: " + err.Error())
+	}
+	return secret
+}
+
+// hashPassword returns the bcrypt hash stored for password, or "" for no
+// password, responding with an error if it cannot be hashed
+func (h *Handler) hashPassword(w http.ResponseWriter, password string) (string, bool) {
+	if password == "" {
+		return "", true
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			h.respondWithError(w, http.StatusBadRequest, "Invalid password", "Must be at most 72 bytes")
+			return "", false
+		}
+		h.respondWithError(w, http.StatusInternalServerError, "Failed to hash password", err.Error())
+		return "", false
+	}
+	return string(hash), true
+}
+
+// UnlockURL handles the password form of a protected short URL. A correct
+// password sets a cookie that unlocks the link and sends the visitor back
+// to it.
+func (h *Handler) UnlockURL(w http.ResponseWriter, r *http.Request) {
+	// Extract shortcode from path
+	shortcode := h.canonicalShortcode(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "+"))
+
+	// Get URL from store
+	shortURL, err := h.store.Get(r.Context(), shortcode)
+	if errors.Is(err, storage.ErrShortcodeNotActive) {
+		h.respondNotActive(w, shortURL)
+		return
+	}
+	if err != nil {
+		h.respondWithLookupError(w, err)
+		return
+	}
+	if shortURL.PasswordHash == "" {
+		http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+		return
+	}
+
+	// Throttle guessing per link and client; without the attempt counts
+	// passwords cannot be checked safely
+	result, err := h.passwordAttempts.Take(r.Context(), "password:"+shortcode+":"+clientIP(r), h.passwordAttemptLimit)
+	if err != nil {
+		h.logger.Error("Failed to throttle password attempt", map[string]interface{}{
+			"shortcode": shortcode,
+			"error":     err.Error(),
+		})
+		h.respondWithPasswordForm(w, r, http.StatusServiceUnavailable, shortcode, "Password check is unavailable, please try again later")
+		return
+	}
+	if !result.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+		h.respondWithPasswordForm(w, r, http.StatusTooManyRequests, shortcode, "Too many attempts, please try again later")
+		return
+	}
+
+	// Check password
+	if bcrypt.CompareHashAndPassword([]byte(shortURL.PasswordHash), []byte(r.PostFormValue("password"))) != nil {
+		h.logger.Info("Rejected password for short URL", map[string]interface{}{
+			"shortcode": shortcode,
+		})
+		h.respondWithPasswordForm(w, r, http.StatusUnauthorized, shortcode, "Incorrect password")
+		return
+	}
+
+	// Remember the unlock and go back to the link
+	http.SetCookie(w, &http.Cookie{
+		Name:     unlockCookiePrefix + shortcode,
+		Value:    h.signUnlock(shortURL, time.Now().Add(unlockLifetime)),
+		Path:     "/",
+		MaxAge:   int(unlockLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+}
+
+// respondWithPasswordForm asks for the password of shortcode, explaining
+// why with message if set. Without pages, a JSON error is sent instead.
+func (h *Handler) respondWithPasswordForm(w http.ResponseWriter, r *http.Request, status int, shortcode, message string) {
+	if h.pages == nil {
+		if message == "" {
+			message = "Password required"
+		}
+		h.respondWithError(w, status, message, "POST the password as the password form field")
+		return
+	}
+
+	h.renderPage(w, status, passwordPage, map[string]interface{}{
+		"Shortcode": shortcode,
+		"Error":     message,
+		"ActionURL": r.URL.Path,
+	})
+}
+
+// unlocked reports whether r carries a valid unlock cookie for shortURL
+func (h *Handler) unlocked(r *http.Request, shortURL models.ShortURL) bool {
+	cookie, err := r.Cookie(unlockCookiePrefix + shortURL.ID)
+	if err != nil {
+		return false
+	}
+
+	expiry, _, found := strings.Cut(cookie.Value, ".")
+	if !found {
+		return false
+	}
+	seconds, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().After(time.Unix(seconds, 0)) {
+		return false
+	}
+	return hmac.Equal([]byte(cookie.Value), []byte(h.signUnlock(shortURL, time.Unix(seconds, 0))))
+}
+
+// signUnlock returns an unlock cookie value for shortURL valid until expiry.
+// The signature covers the password hash, so changing the password locks
+// the link again.
+func (h *Handler) signUnlock(shortURL models.ShortURL, expiry time.Time) string {
+	value := strconv.FormatInt(expiry.Unix(), 10)
+	mac := hmac.New(sha256.New, h.cookieSecret)
+	mac.Write([]byte(shortURL.ID + "\n" + value + "\n" + shortURL.PasswordHash))
+	return value + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// clientIP returns the address of the client making r
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,171 @@
+package janitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"12217467/backend_test_submission/internal/middleware"
+	"12217467/backend_test_submission/internal/models"
+	"12217467/backend_test_submission/internal/storage"
+)
+
+const (
+	// DefaultInterval is how often the janitor sweeps when no interval is configured
+	DefaultInterval = time.Minute
+)
+
+// Archiver receives expired short URLs before they are purged
+type Archiver interface {
+	Archive(urls []models.ShortURL) error
+}
+
+// Config configures a Janitor
+type Config struct {
+	// Interval between sweeps (defaults to DefaultInterval)
+	Interval time.Duration
+
+	// GracePeriod keeps expired short URLs around for this long so that
+	// clients keep receiving 410 Gone before the link turns into a 404
+	GracePeriod time.Duration
+
+	// Archiver, if set, receives expired short URLs before they are purged
+	Archiver Archiver
+}
+
+// Stats reports what the janitor has done since it was created
+type Stats struct {
+	Sweeps     int64     `json:"sweeps"`     // Number of completed sweeps
+	Failures   int64     `json:"failures"`   // Number of sweeps that returned an error
+	Purged     int64     `json:"purged"`     // Total number of short URLs removed
+	LastPurged int       `json:"lastPurged"` // Short URLs removed by the most recent sweep
+	LastSweep  time.Time `json:"lastSweep"`  // When the most recent sweep finished
+}
+
+// Janitor periodically removes expired short URLs from a store
+type Janitor struct {
+	store  storage.ExpiredPurger
+	logger middleware.Logger
+	config Config
+
+	mutex sync.Mutex
+	stats Stats
+}
+
+// New creates a Janitor for store
+func New(store storage.ExpiredPurger, logger middleware.Logger, config Config) *Janitor {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	return &Janitor{
+		store:  store,
+		logger: logger,
+		config: config,
+	}
+}
+
+// Run sweeps every configured interval until ctx is cancelled
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.config.Interval)
+	defer ticker.Stop()
+
+	j.logger.Info("Expiry janitor started", map[string]interface{}{
+		"interval":     j.config.Interval.String(),
+		"grace_period": j.config.GracePeriod.String(),
+	})
+
+	for {
+		select {
+		case <-ctx.Done():
+			j.logger.Info("Expiry janitor stopped", nil)
+			return
+		case <-ticker.C:
+			j.Sweep(ctx)
+		}
+	}
+}
+
+// Sweep purges every short URL that expired more than the grace period ago
+// and returns how many were removed
+func (j *Janitor) Sweep(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-j.config.GracePeriod)
+
+	var archive func([]models.ShortURL) error
+	if j.config.Archiver != nil {
+		archive = j.config.Archiver.Archive
+	}
+
+	purged, err := j.store.PurgeExpired(ctx, cutoff, archive)
+
+	j.mutex.Lock()
+	j.stats.Sweeps++
+	j.stats.Purged += int64(purged)
+	j.stats.LastPurged = purged
+	j.stats.LastSweep = time.Now()
+	if err != nil {
+		j.stats.Failures++
+	}
+	j.mutex.Unlock()
+
+	if err != nil {
+		j.logger.Error("Failed to purge expired short URLs", map[string]interface{}{
+			"purged": purged,
+			"error":  err.Error(),
+		})
+		return purged, err
+	}
+
+	if purged > 0 {
+		j.logger.Info("Purged expired short URLs", map[string]interface{}{
+			"purged": purged,
+			"cutoff": cutoff.Format(time.RFC3339),
+		})
+	}
+	return purged, nil
+}
+
+// Stats returns a snapshot of the janitor's counters
+func (j *Janitor) Stats() Stats {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.stats
+}
+
+// FileArchiver appends expired short URLs to a file as JSON lines
+type FileArchiver struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// NewFileArchiver creates a FileArchiver writing to path
+func NewFileArchiver(path string) *FileArchiver {
+	return &FileArchiver{path: path}
+}
+
+// Archive appends urls to the archive file
+func (a *FileArchiver) Archive(urls []models.ShortURL) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, shortURL := range urls {
+		if err := encoder.Encode(shortURL); err != nil {
+			file.Close()
+			return fmt.Errorf("write archive: %w", err)
+		}
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("sync archive: %w", err)
+	}
+	return file.Close()
+}
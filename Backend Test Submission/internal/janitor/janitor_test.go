@@ -0,0 +1,118 @@
+package janitor
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"12217467/backend_test_submission/internal/models"
+	"12217467/backend_test_submission/internal/storage"
+)
+
+// MockLogger is a simple mock implementation of the Logger interface for testing
+type MockLogger struct{}
+
+func (l *MockLogger) Info(msg string, fields map[string]interface{})  {}
+func (l *MockLogger) Error(msg string, fields map[string]interface{}) {}
+func (l *MockLogger) Debug(msg string, fields map[string]interface{}) {}
+
+func TestSweep(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	store := storage.NewURLStore()
+	now := time.Now()
+	for id, expiresAt := range map[string]time.Time{
+		"active":   now.Add(time.Hour),
+		"graced":   now.Add(-time.Minute),
+		"obsolete": now.Add(-2 * time.Hour),
+	} {
+		store.Create(ctx, models.ShortURL{ID: id, OriginalURL: "https://example.com", CreatedAt: now, ExpiresAt: expiresAt})
+	}
+	store.Create(ctx, models.ShortURL{
+		ID:          "fallback",
+		OriginalURL: "https://example.com",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(-2 * time.Hour),
+		FallbackURL: "https://example.com/expired",
+	})
+
+	archivePath := filepath.Join(t.TempDir(), "archive.jsonl")
+	janitor := New(store, &MockLogger{}, Config{
+		GracePeriod: time.Hour,
+		Archiver:    NewFileArchiver(archivePath),
+	})
+
+	// Test case: Only entries past the grace period are purged
+	t.Run("Purge past grace period", func(t *testing.T) {
+		purged, err := janitor.Sweep(ctx)
+		if err != nil {
+			t.Fatalf("Sweep failed: %v", err)
+		}
+		if purged != 1 {
+			t.Errorf("Expected 1 purged entry, got %d", purged)
+		}
+		if store.ShortcodeExists(ctx, "obsolete") {
+			t.Error("Expected obsolete entry to be purged")
+		}
+		if !store.ShortcodeExists(ctx, "active") || !store.ShortcodeExists(ctx, "graced") {
+			t.Error("Expected active and graced entries to be kept")
+		}
+		if !store.ShortcodeExists(ctx, "fallback") {
+			t.Error("Expected entry with a fallback to be kept")
+		}
+	})
+
+	// Test case: Purged entries are archived
+	t.Run("Archive", func(t *testing.T) {
+		file, err := os.Open(archivePath)
+		if err != nil {
+			t.Fatalf("Failed to open archive: %v", err)
+		}
+		defer file.Close()
+
+		lines := 0
+		for scanner := bufio.NewScanner(file); scanner.Scan(); {
+			lines++
+		}
+		if lines != 1 {
+			t.Errorf("Expected 1 archived entry, got %d", lines)
+		}
+	})
+
+	// Test case: Metrics track sweeps
+	t.Run("Stats", func(t *testing.T) {
+		janitor.Sweep(ctx)
+
+		stats := janitor.Stats()
+		if stats.Sweeps != 2 || stats.Purged != 1 || stats.LastPurged != 0 {
+			t.Errorf("Unexpected stats: %+v", stats)
+		}
+	})
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	// Setup
+	janitor := New(storage.NewURLStore(), &MockLogger{}, Config{Interval: time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		janitor.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Run to return after cancellation")
+	}
+	if janitor.Stats().Sweeps == 0 {
+		t.Error("Expected at least one sweep before cancellation")
+	}
+}
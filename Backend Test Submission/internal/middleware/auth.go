@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"12217467/backend_test_submission/internal/models"
+)
+
+// APIKeyHeader is the request header that carries an API key
+const APIKeyHeader = "X-API-Key"
+
+// Scopes granted to callers
+const (
+	// ScopeCreate allows creating short URLs and changing one's own
+	ScopeCreate = "links:create"
+
+	// ScopeReadStats allows reading the statistics of one's own short URLs
+	ScopeReadStats = "links:read-stats"
+
+	// ScopeAdmin allows managing every short URL regardless of its owner
+	ScopeAdmin = "links:admin"
+)
+
+// DefaultAPIKeyScopes are granted to API keys that do not list any scopes
+var DefaultAPIKeyScopes = []string{ScopeCreate, ScopeReadStats}
+
+// Prefixes of principal IDs, which keep API key owners and token subjects
+// with the same name apart
+const (
+	APIKeyPrincipalPrefix = "key:"
+	JWTPrincipalPrefix    = "jwt:"
+)
+
+// ErrUnknownAPIKey is returned by a KeyStore for keys it does not know
+var ErrUnknownAPIKey = errors.New("unknown API key")
+
+// Principal identifies the authenticated caller of a request
+type Principal struct {
+	ID     string   // Stable identifier recorded as the owner of short URLs, prefixed by its source
+	Scopes []string // Scopes granted to the caller
+}
+
+// HasScope reports whether the principal was granted scope
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// principalKey is the context key under which the Principal is stored
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying principal
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the authenticated caller stored in ctx, if any
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// KeyStore resolves API keys to the principals they belong to
+type KeyStore interface {
+	// Lookup returns the owner of key, or ErrUnknownAPIKey
+	Lookup(ctx context.Context, key string) (Principal, error)
+}
+
+// fileKey is one entry of a key file
+type fileKey struct {
+	Owner   string   `json:"owner"`   // Owner ID recorded on short URLs
+	KeyHash string   `json:"keyHash"` // Hex-encoded SHA-256 of the key
+	Scopes  []string `json:"scopes"`  // Granted scopes (defaults to DefaultAPIKeyScopes)
+}
+
+// FileKeyStore is a KeyStore backed by a JSON file listing the SHA-256
+// hashes of the accepted keys, so the file never contains the keys themselves
+type FileKeyStore struct {
+	keys map[[sha256.Size]byte]Principal
+}
+
+// LoadFileKeyStore reads a key file of the form
+//
+//	[{"owner": "alice", "keyHash": "<hex sha256 of the key>", "scopes": ["links:create"]}]
+func LoadFileKeyStore(path string) (*FileKeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+
+	var entries []fileKey
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse key file: %w", err)
+	}
+
+	s := &FileKeyStore{keys: make(map[[sha256.Size]byte]Principal, len(entries))}
+	for i, entry := range entries {
+		if entry.Owner == "" {
+			return nil, fmt.Errorf("key %d: owner is required", i)
+		}
+		hash, err := hex.DecodeString(entry.KeyHash)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("key %d: keyHash must be a hex-encoded SHA-256", i)
+		}
+		scopes := entry.Scopes
+		if len(scopes) == 0 {
+			scopes = DefaultAPIKeyScopes
+		}
+		s.keys[[sha256.Size]byte(hash)] = Principal{ID: entry.Owner, Scopes: scopes}
+	}
+	return s, nil
+}
+
+// Lookup returns the owner of key, or ErrUnknownAPIKey
+func (s *FileKeyStore) Lookup(_ context.Context, key string) (Principal, error) {
+	principal, ok := s.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return Principal{}, ErrUnknownAPIKey
+	}
+	return principal, nil
+}
+
+// APIKeyAuth creates a middleware that authenticates requests carrying an
+// X-API-Key header and stores the caller in the request context. Requests
+// without a key pass through anonymously so that redirects keep working;
+// handlers decide what anonymous callers may do. The key's owner is
+// prefixed with APIKeyPrincipalPrefix to form the principal ID.
+func APIKeyAuth(keys KeyStore, logger Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(APIKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			principal, err := keys.Lookup(r.Context(), key)
+			if err != nil {
+				if errors.Is(err, ErrUnknownAPIKey) {
+					writeError(w, http.StatusUnauthorized, "Invalid API key")
+					return
+				}
+				logger.Error("Failed to look up API key", map[string]interface{}{
+					"error": err.Error(),
+				})
+				writeError(w, http.StatusInternalServerError, "Failed to authenticate request")
+				return
+			}
+
+			principal.ID = APIKeyPrincipalPrefix + principal.ID
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// writeError sends a JSON error response in the same format as the API
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Error: message, Code: status})
+}
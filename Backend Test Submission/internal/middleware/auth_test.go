@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// MockLogger is a simple mock implementation of the Logger interface for testing
+type MockLogger struct{}
+
+func (l *MockLogger) Info(msg string, fields map[string]interface{})  {}
+func (l *MockLogger) Error(msg string, fields map[string]interface{}) {}
+func (l *MockLogger) Debug(msg string, fields map[string]interface{}) {}
+
+func TestAPIKeyAuth(t *testing.T) {
+	// Setup
+	hash := sha256.Sum256([]byte("secret-key"))
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `[{"owner": "alice", "keyHash": "` + hex.EncodeToString(hash[:]) + `"}]`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	keys, err := LoadFileKeyStore(path)
+	if err != nil {
+		t.Fatalf("Failed to load key file: %v", err)
+	}
+
+	var principal Principal
+	var authenticated bool
+	handler := APIKeyAuth(keys, &MockLogger{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, authenticated = PrincipalFromContext(r.Context())
+	}))
+
+	// Test case: Valid key
+	t.Run("Valid key", func(t *testing.T) {
+		// Create request
+		req := httptest.NewRequest("GET", "/shorturls/abc", nil)
+		req.Header.Set(APIKeyHeader, "secret-key")
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.ServeHTTP(w, req)
+
+		// Check response
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		if !authenticated || principal.ID != "key:alice" {
+			t.Errorf("Expected principal key:alice, got %+v (authenticated: %v)", principal, authenticated)
+		}
+	})
+
+	// Test case: Unknown key
+	t.Run("Unknown key", func(t *testing.T) {
+		// Create request
+		req := httptest.NewRequest("GET", "/shorturls/abc", nil)
+		req.Header.Set(APIKeyHeader, "wrong-key")
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.ServeHTTP(w, req)
+
+		// Check response
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+	})
+
+	// Test case: Requests without a key pass through anonymously
+	t.Run("No key", func(t *testing.T) {
+		// Create request
+		req := httptest.NewRequest("GET", "/abc", nil)
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.ServeHTTP(w, req)
+
+		// Check response
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		if authenticated {
+			t.Error("Expected anonymous request")
+		}
+	})
+}
@@ -0,0 +1,290 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Signing algorithms accepted by JWTVerifier
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+)
+
+// ErrInvalidToken is returned for bearer tokens that fail verification
+var ErrInvalidToken = errors.New("invalid token")
+
+// jwk is a JSON Web Key as found in a JWKS file
+type jwk struct {
+	Kty string `json:"kty"` // "oct" for HMAC secrets, "RSA" for RSA public keys
+	Kid string `json:"kid"` // Key ID matched against the token header
+	Alg string `json:"alg"` // Optional; must match the token if set
+	K   string `json:"k"`   // Base64url-encoded HMAC secret
+	N   string `json:"n"`   // Base64url-encoded RSA modulus
+	E   string `json:"e"`   // Base64url-encoded RSA exponent
+}
+
+// jwtKey is a verification key parsed from a JWKS file
+type jwtKey struct {
+	kid    string
+	alg    string
+	secret []byte
+	public *rsa.PublicKey
+}
+
+// JWKS holds the keys used to verify bearer tokens
+type JWKS struct {
+	keys []jwtKey
+}
+
+// LoadJWKS reads a JSON Web Key Set file. HMAC secrets ("kty": "oct") verify
+// HS256 tokens and RSA public keys ("kty": "RSA") verify RS256 tokens.
+func LoadJWKS(path string) (*JWKS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS file: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse JWKS file: %w", err)
+	}
+
+	jwks := &JWKS{}
+	for i, k := range set.Keys {
+		key, err := parseJWK(k)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		jwks.keys = append(jwks.keys, key)
+	}
+	if len(jwks.keys) == 0 {
+		return nil, errors.New("JWKS file contains no keys")
+	}
+	return jwks, nil
+}
+
+// parseJWK converts a JWK into a verification key. Each key is bound to a
+// single algorithm so that an RSA public key can never be used as an HMAC
+// secret.
+func parseJWK(k jwk) (jwtKey, error) {
+	switch k.Kty {
+	case "oct":
+		if k.Alg != "" && k.Alg != AlgHS256 {
+			return jwtKey{}, fmt.Errorf("unsupported algorithm %q for oct key", k.Alg)
+		}
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return jwtKey{}, errors.New("invalid oct key")
+		}
+		return jwtKey{kid: k.Kid, alg: AlgHS256, secret: secret}, nil
+	case "RSA":
+		if k.Alg != "" && k.Alg != AlgRS256 {
+			return jwtKey{}, fmt.Errorf("unsupported algorithm %q for RSA key", k.Alg)
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return jwtKey{}, errors.New("invalid RSA key")
+		}
+		public := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		return jwtKey{kid: k.Kid, alg: AlgRS256, public: public}, nil
+	default:
+		return jwtKey{}, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// JWTConfig configures the claims a JWTVerifier accepts
+type JWTConfig struct {
+	// Issuer, if set, must match the iss claim
+	Issuer string
+
+	// Audience, if set, must be listed in the aud claim
+	Audience string
+
+	// Leeway tolerates clock skew when checking exp and nbf
+	Leeway time.Duration
+}
+
+// JWTVerifier validates HS256 and RS256 bearer tokens
+type JWTVerifier struct {
+	keys   *JWKS
+	config JWTConfig
+	now    func() time.Time
+}
+
+// NewJWTVerifier creates a JWTVerifier for tokens signed with keys
+func NewJWTVerifier(keys *JWKS, config JWTConfig) *JWTVerifier {
+	return &JWTVerifier{keys: keys, config: config, now: time.Now}
+}
+
+// jwtClaims lists the registered and scope claims read from a token
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+	Scope     string          `json:"scope"` // Space-separated scopes (RFC 8693)
+	Scp       []string        `json:"scp"`   // Scope list, as issued by some providers
+}
+
+// Verify checks token's signature and claims and returns the caller it
+// identifies. The sub claim becomes the principal ID.
+func (v *JWTVerifier) Verify(token string) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Principal{}, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: signature encoding", ErrInvalidToken)
+	}
+	if !v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature) {
+		return Principal{}, fmt.Errorf("%w: signature", ErrInvalidToken)
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	scopes := claims.Scp
+	if claims.Scope != "" {
+		scopes = strings.Fields(claims.Scope)
+	}
+	return Principal{ID: claims.Subject, Scopes: scopes}, nil
+}
+
+// verifySignature reports whether any key bound to alg (and kid, if the
+// token names one) produced signature over signingInput
+func (v *JWTVerifier) verifySignature(alg, kid, signingInput string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signingInput))
+	for _, key := range v.keys.keys {
+		if key.alg != alg || (kid != "" && key.kid != kid) {
+			continue
+		}
+		switch alg {
+		case AlgHS256:
+			mac := hmac.New(sha256.New, key.secret)
+			mac.Write([]byte(signingInput))
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return true
+			}
+		case AlgRS256:
+			if rsa.VerifyPKCS1v15(key.public, crypto.SHA256, digest[:], signature) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkClaims validates the time, issuer, audience and subject claims
+func (v *JWTVerifier) checkClaims(claims jwtClaims) error {
+	now := v.now()
+	if claims.ExpiresAt == nil {
+		return errors.New("missing exp claim")
+	}
+	if now.After(time.Unix(*claims.ExpiresAt, 0).Add(v.config.Leeway)) {
+		return errors.New("token has expired")
+	}
+	if claims.NotBefore != nil && now.Add(v.config.Leeway).Before(time.Unix(*claims.NotBefore, 0)) {
+		return errors.New("token is not valid yet")
+	}
+	if v.config.Issuer != "" && claims.Issuer != v.config.Issuer {
+		return errors.New("unexpected issuer")
+	}
+	if v.config.Audience != "" && !audienceContains(claims.Audience, v.config.Audience) {
+		return errors.New("unexpected audience")
+	}
+	if claims.Subject == "" {
+		return errors.New("missing sub claim")
+	}
+	return nil
+}
+
+// audienceContains reports whether the aud claim, a string or a list of
+// strings, names audience
+func audienceContains(raw json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == audience
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		for _, aud := range list {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url-encoded JSON token segment into v
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// JWTAuth creates a middleware that authenticates requests carrying an
+// "Authorization: Bearer" header and stores the caller in the request
+// context. Requests without a bearer token pass through unchanged. The
+// token's subject is prefixed with JWTPrincipalPrefix to form the principal
+// ID.
+func JWTAuth(verifier *JWTVerifier, logger Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !found || !strings.EqualFold(scheme, "Bearer") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			principal, err := verifier.Verify(strings.TrimSpace(token))
+			if err != nil {
+				logger.Debug("Rejected bearer token", map[string]interface{}{
+					"error": err.Error(),
+				})
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeError(w, http.StatusUnauthorized, "Invalid bearer token")
+				return
+			}
+
+			principal.ID = JWTPrincipalPrefix + principal.ID
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
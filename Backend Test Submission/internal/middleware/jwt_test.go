@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// signToken builds a compact JWT, signing it with secret (HS256) or key (RS256)
+func signToken(t *testing.T, header, claims map[string]interface{}, secret []byte, key *rsa.PrivateKey) string {
+	t.Helper()
+
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Failed to encode token segment: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signingInput := encode(header) + "." + encode(claims)
+
+	var signature []byte
+	if key != nil {
+		digest := sha256.Sum256([]byte(signingInput))
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+	} else {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerifier(t *testing.T) {
+	// Setup
+	secret := []byte("hmac-secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "oct", "kid": "hmac", "k": base64.RawURLEncoding.EncodeToString(secret)},
+			{
+				"kty": "RSA",
+				"kid": "rsa",
+				"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+		},
+	}
+	data, _ := json.Marshal(jwks)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write JWKS file: %v", err)
+	}
+	keys, err := LoadJWKS(path)
+	if err != nil {
+		t.Fatalf("Failed to load JWKS: %v", err)
+	}
+	verifier := NewJWTVerifier(keys, JWTConfig{Issuer: "platform", Audience: "shortener"})
+
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":   "alice",
+			"iss":   "platform",
+			"aud":   []string{"shortener"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"scope": "links:create links:read-stats",
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	// Test case: Valid HS256 and RS256 tokens
+	t.Run("Valid tokens", func(t *testing.T) {
+		tokens := map[string]string{
+			AlgHS256: signToken(t, map[string]interface{}{"alg": AlgHS256, "kid": "hmac"}, claims(nil), secret, nil),
+			AlgRS256: signToken(t, map[string]interface{}{"alg": AlgRS256, "kid": "rsa"}, claims(nil), nil, rsaKey),
+		}
+		for alg, token := range tokens {
+			principal, err := verifier.Verify(token)
+			if err != nil {
+				t.Fatalf("%s: expected valid token, got %v", alg, err)
+			}
+			if principal.ID != "alice" || !principal.HasScope(ScopeCreate) || !principal.HasScope(ScopeReadStats) {
+				t.Errorf("%s: unexpected principal %+v", alg, principal)
+			}
+		}
+	})
+
+	// Test case: Invalid tokens are rejected
+	t.Run("Invalid tokens", func(t *testing.T) {
+		tests := map[string]string{
+			"Wrong secret":    signToken(t, map[string]interface{}{"alg": AlgHS256}, claims(nil), []byte("other"), nil),
+			"Expired":         signToken(t, map[string]interface{}{"alg": AlgHS256}, claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}), secret, nil),
+			"Wrong issuer":    signToken(t, map[string]interface{}{"alg": AlgHS256}, claims(map[string]interface{}{"iss": "elsewhere"}), secret, nil),
+			"Wrong audience":  signToken(t, map[string]interface{}{"alg": AlgHS256}, claims(map[string]interface{}{"aud": "other"}), secret, nil),
+			"Unsupported alg": signToken(t, map[string]interface{}{"alg": "none"}, claims(nil), secret, nil),
+			"Malformed":       "not-a-token",
+		}
+		for name, token := range tests {
+			if _, err := verifier.Verify(token); err == nil {
+				t.Errorf("%s: expected token to be rejected", name)
+			}
+		}
+	})
+
+	// Test case: The middleware rejects bad tokens and ignores requests without one
+	t.Run("Middleware", func(t *testing.T) {
+		var principal Principal
+		handler := JWTAuth(verifier, &MockLogger{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, _ = PrincipalFromContext(r.Context())
+		}))
+
+		// Create request
+		req := httptest.NewRequest("GET", "/shorturls/abc", nil)
+		req.Header.Set("Authorization", "Bearer "+signToken(t, map[string]interface{}{"alg": AlgHS256}, claims(nil), secret, nil))
+		w := httptest.NewRecorder()
+
+		// Call handler
+		handler.ServeHTTP(w, req)
+
+		// Check response
+		if w.Code != http.StatusOK || principal.ID != "jwt:alice" {
+			t.Errorf("Expected authenticated request, got status %d and principal %+v", w.Code, principal)
+		}
+
+		// Create request
+		req = httptest.NewRequest("GET", "/shorturls/abc", nil)
+		req.Header.Set("Authorization", "Bearer invalid")
+		w = httptest.NewRecorder()
+
+		// Call handler
+		handler.ServeHTTP(w, req)
+
+		// Check response
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+
+		// Create request
+		w = httptest.NewRecorder()
+
+		// Call handler
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/abc", nil))
+
+		// Check response
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+	})
+}
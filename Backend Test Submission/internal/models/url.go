@@ -4,45 +4,105 @@ import (
 	"time"
 )
 
+// NeverExpires is the ExpiresAt of links that do not expire. A far-future
+// time keeps every store's expiry handling unchanged.
+var NeverExpires = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
 // ShortURL represents a shortened URL with its metadata
 type ShortURL struct {
-	ID          string    `json:"id"`          // Unique identifier (shortcode)
-	OriginalURL string    `json:"originalUrl"` // Original long URL
-	CreatedAt   time.Time `json:"createdAt"`   // Creation timestamp
-	ExpiresAt   time.Time `json:"expiresAt"`   // Expiration timestamp
-	Clicks      int       `json:"clicks"`      // Number of times the URL has been accessed
-	ClickData   []Click   `json:"clickData"`   // Detailed click data
+	ID            string         `json:"id"`            // Unique identifier (shortcode)
+	OriginalURL   string         `json:"originalUrl"`   // Original long URL
+	CreatedAt     time.Time      `json:"createdAt"`     // Creation timestamp
+	ExpiresAt     time.Time      `json:"expiresAt"`     // Expiration timestamp
+	Clicks        int            `json:"clicks"`        // Number of times the URL has been accessed
+	ClickData     []Click        `json:"clickData"`     // Detailed click data
+	Owner         string         `json:"owner"`         // ID of the API key that created the URL (empty if anonymous)
+	Preview       bool           `json:"preview"`       // Show a preview page instead of redirecting directly
+	RedirectType  int            `json:"redirectType"`  // HTTP status used for redirects (0 means 302)
+	PasswordHash  string         `json:"passwordHash"`  // Bcrypt hash of the password protecting the link (empty if none)
+	MaxClicks     int            `json:"maxClicks"`     // Redirects allowed before the link stops working (0 means unlimited)
+	ActivatesAt   time.Time      `json:"activatesAt"`   // Time before which the link does not resolve (zero means immediately)
+	FallbackURL   string         `json:"fallbackUrl"`   // Where visitors are sent once the link has expired (empty for the server default)
+	RedirectRules []RedirectRule `json:"redirectRules"` // Destinations for particular clients, tried in order before OriginalURL
+	Deleted       bool           `json:"deleted"`       // Tombstone left by a deletion, which keeps the shortcode taken
+}
+
+// RedirectRule sends clients matching every condition it sets to URL
+// instead of the original URL. At least one condition must be set.
+type RedirectRule struct {
+	OS     string `json:"os,omitempty"`     // Operating system: ios, android, windows, macos, linux or chromeos
+	Device string `json:"device,omitempty"` // Device class: mobile, tablet or desktop
+	Bot    *bool  `json:"bot,omitempty"`    // Whether the client must (true) or must not (false) be a bot
+	URL    string `json:"url"`              // Destination for matching clients
 }
 
 // Click represents a single click event on a shortened URL
 type Click struct {
-	Timestamp time.Time `json:"timestamp"` // When the click occurred
-	Referrer  string    `json:"referrer"`  // Where the click came from
-	Location  string    `json:"location"`  // Approximate geographical location
-	UserAgent string    `json:"userAgent"` // User agent of the client
+	Timestamp   time.Time `json:"timestamp"`             // When the click occurred
+	Referrer    string    `json:"referrer"`              // Where the click came from
+	Location    string    `json:"location"`              // Approximate geographical location
+	UserAgent   string    `json:"userAgent"`             // User agent of the client
+	MatchedRule *int      `json:"matchedRule,omitempty"` // Index of the redirect rule that picked the destination (nil for the original URL)
 }
 
 // CreateShortURLRequest represents the request body for creating a short URL
 type CreateShortURLRequest struct {
-	URL       string `json:"url"`       // Original URL to shorten
-	Validity  *int   `json:"validity"`  // Optional validity period in minutes
-	Shortcode string `json:"shortcode"` // Optional custom shortcode
+	URL           string         `json:"url"`           // Original URL to shorten
+	Validity      *int           `json:"validity"`      // Optional validity period in minutes
+	ValidFor      string         `json:"validFor"`      // Optional ISO-8601 validity period, e.g. "P7D"
+	ExpiresAt     *time.Time     `json:"expiresAt"`     // Optional absolute expiry
+	NeverExpires  bool           `json:"neverExpires"`  // Optional; keep the link forever, if the policy allows it
+	Shortcode     string         `json:"shortcode"`     // Optional custom shortcode
+	Preview       bool           `json:"preview"`       // Optional; show a preview page before redirecting
+	RedirectType  int            `json:"redirectType"`  // Optional redirect status: 301, 302, 307 or 308 (defaults to 302)
+	Password      string         `json:"password"`      // Optional password visitors must enter before being redirected
+	MaxClicks     int            `json:"maxClicks"`     // Optional number of redirects after which the link stops working
+	ActivatesAt   *time.Time     `json:"activatesAt"`   // Optional launch time; validity is then counted from it
+	FallbackURL   string         `json:"fallbackUrl"`   // Optional destination once the link has expired
+	RedirectRules []RedirectRule `json:"redirectRules"` // Optional per-client destinations, tried in order
 }
 
 // CreateShortURLResponse represents the response for a successful short URL creation
 type CreateShortURLResponse struct {
-	ShortLink string    `json:"shortLink"` // The complete shortened URL
-	Expiry    time.Time `json:"expiry"`    // Expiration timestamp
+	ShortLink    string     `json:"shortLink"`             // The complete shortened URL
+	Expiry       time.Time  `json:"expiry"`                // Expiration timestamp (NeverExpires if the link does not expire)
+	NeverExpires bool       `json:"neverExpires"`          // Whether the link never expires
+	ActivatesAt  *time.Time `json:"activatesAt,omitempty"` // Launch time, if the link is scheduled
+}
+
+// UpdateShortURLRequest represents the request body for updating a short URL.
+// Omitted fields are left unchanged.
+type UpdateShortURLRequest struct {
+	URL           *string         `json:"url"`           // New original URL
+	Validity      *int            `json:"validity"`      // New validity period in minutes, counted from now
+	ValidFor      string          `json:"validFor"`      // New ISO-8601 validity period, counted from now
+	ExpiresAt     *time.Time      `json:"expiresAt"`     // New absolute expiry
+	NeverExpires  bool            `json:"neverExpires"`  // Keep the link forever, if the policy allows it
+	Preview       *bool           `json:"preview"`       // Whether to show a preview page before redirecting
+	RedirectType  *int            `json:"redirectType"`  // New redirect status: 301, 302, 307 or 308
+	Password      *string         `json:"password"`      // New password; empty removes the protection
+	MaxClicks     *int            `json:"maxClicks"`     // New click limit; 0 removes the limit
+	ActivatesAt   *time.Time      `json:"activatesAt"`   // New launch time; a past time activates the link
+	FallbackURL   *string         `json:"fallbackUrl"`   // New destination once the link has expired; empty removes it
+	RedirectRules *[]RedirectRule `json:"redirectRules"` // New per-client destinations; an empty list removes them
 }
 
 // URLStatsResponse represents the response for URL statistics
 type URLStatsResponse struct {
-	Shortcode   string    `json:"shortcode"`   // The shortcode
-	OriginalURL string    `json:"originalUrl"` // Original long URL
-	CreatedAt   time.Time `json:"createdAt"`   // Creation timestamp
-	ExpiresAt   time.Time `json:"expiresAt"`   // Expiration timestamp
-	Clicks      int       `json:"clicks"`      // Total number of clicks
-	ClickData   []Click   `json:"clickData"`   // Detailed click data
+	Shortcode         string         `json:"shortcode"`               // The shortcode
+	OriginalURL       string         `json:"originalUrl"`             // Original long URL
+	CreatedAt         time.Time      `json:"createdAt"`               // Creation timestamp
+	ExpiresAt         time.Time      `json:"expiresAt"`               // Expiration timestamp (NeverExpires if the link does not expire)
+	NeverExpires      bool           `json:"neverExpires"`            // Whether the link never expires
+	Clicks            int            `json:"clicks"`                  // Total number of clicks
+	ClickData         []Click        `json:"clickData"`               // Detailed click data
+	Preview           bool           `json:"preview"`                 // Whether a preview page is shown before redirecting
+	RedirectType      int            `json:"redirectType"`            // HTTP status used for redirects
+	PasswordProtected bool           `json:"passwordProtected"`       // Whether visitors must enter a password
+	MaxClicks         int            `json:"maxClicks"`               // Redirects allowed in total (0 means unlimited)
+	ActivatesAt       *time.Time     `json:"activatesAt,omitempty"`   // Launch time, if the link is scheduled
+	FallbackURL       string         `json:"fallbackUrl,omitempty"`   // Destination once the link has expired, if set
+	RedirectRules     []RedirectRule `json:"redirectRules,omitempty"` // Per-client destinations, tried in order
 }
 
 // ErrorResponse represents an API error response
@@ -0,0 +1,182 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"12217467/backend_test_submission/internal/middleware"
+	"12217467/backend_test_submission/internal/models"
+)
+
+// Route classes with separate limits
+const (
+	// ClassCreate covers POST /shorturls
+	ClassCreate = "create"
+
+	// ClassStats covers the /shorturls/{code} management endpoints
+	ClassStats = "stats"
+
+	// ClassRedirect covers shortcode redirects
+	ClassRedirect = "redirect"
+)
+
+// Limit describes a token bucket: up to Requests requests in a burst, with
+// the bucket refilling completely over Per
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseLimit parses a limit written as "<requests>/<duration>", such as
+// "10/1m" or "100/1s"
+func ParseLimit(s string) (Limit, error) {
+	requests, per, found := strings.Cut(s, "/")
+	if !found {
+		return Limit{}, fmt.Errorf("rate limit %q: expected <requests>/<duration>", s)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: requests must be a positive integer", s)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: invalid duration", s)
+	}
+	return Limit{Requests: n, Per: d}, nil
+}
+
+// rate returns how many tokens the bucket regains per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Result reports the state of a bucket after a request
+type Result struct {
+	Allowed    bool          // Whether the request may proceed
+	Remaining  int           // Whole tokens left in the bucket
+	RetryAfter time.Duration // Time until the next token, if not allowed
+	ResetAfter time.Duration // Time until the bucket is full again
+}
+
+// newResult derives a Result from the tokens left in a bucket
+func newResult(limit Limit, tokens float64, allowed bool) Result {
+	result := Result{
+		Allowed:    allowed,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: time.Duration((float64(limit.Requests) - tokens) / limit.rate() * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / limit.rate() * float64(time.Second))
+	}
+	return result
+}
+
+// Store holds token bucket state. Sharing a Store between replicas makes
+// them enforce one combined limit.
+type Store interface {
+	// Take removes a token from the bucket named key, which starts full,
+	// and reports whether one was available
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Config configures the rate limiting middleware
+type Config struct {
+	// Limits maps route classes to their limits. Classes without a limit
+	// are not throttled.
+	Limits map[string]Limit
+
+	// Classify assigns a request to a route class (defaults to RouteClass)
+	Classify func(r *http.Request) string
+}
+
+// RouteClass assigns requests to ClassCreate, ClassStats or ClassRedirect.
+// The index page and static files are not classified.
+func RouteClass(r *http.Request) string {
+	switch {
+	case r.URL.Path == "/shorturls":
+		return ClassCreate
+	case strings.HasPrefix(r.URL.Path, "/shorturls/"):
+		return ClassStats
+	case r.URL.Path == "/" || strings.HasPrefix(r.URL.Path, "/static/"):
+		return ""
+	default:
+		return ClassRedirect
+	}
+}
+
+// Middleware creates a middleware that throttles each client per route
+// class. Authenticated clients are identified by their principal, which
+// the authentication middleware must have stored beforehand; anonymous
+// clients by their IP address. If the store fails, requests are let
+// through rather than turning an outage of the limiter into an outage of
+// the service.
+func Middleware(store Store, logger middleware.Logger, config Config) func(http.Handler) http.Handler {
+	if config.Classify == nil {
+		config.Classify = RouteClass
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			class := config.Classify(r)
+			limit, ok := config.Limits[class]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result, err := store.Take(r.Context(), class+":"+clientKey(r), limit)
+			if err != nil {
+				logger.Error("Failed to apply rate limit", map[string]interface{}{
+					"class": class,
+					"error": err.Error(),
+				})
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Requests))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(w).Encode(models.ErrorResponse{
+					Error:   "Rate limit exceeded",
+					Code:    http.StatusTooManyRequests,
+					Details: fmt.Sprintf("Limit of %d requests per %s for %s requests", limit.Requests, limit.Per, class),
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientKey identifies the client making r
+func clientKey(r *http.Request) string {
+	if principal, ok := middleware.PrincipalFromContext(r.Context()); ok {
+		return "principal:" + principal.ID
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ceilSeconds rounds d up to whole seconds, as used by Retry-After
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"12217467/backend_test_submission/internal/middleware"
+)
+
+// MockLogger is a simple mock implementation of the Logger interface for testing
+type MockLogger struct{}
+
+func (l *MockLogger) Info(msg string, fields map[string]interface{})  {}
+func (l *MockLogger) Error(msg string, fields map[string]interface{}) {}
+func (l *MockLogger) Debug(msg string, fields map[string]interface{}) {}
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ParseLimit("10/1m")
+	if err != nil || limit != (Limit{Requests: 10, Per: time.Minute}) {
+		t.Errorf("Expected 10 requests per minute, got %+v (%v)", limit, err)
+	}
+
+	for _, invalid := range []string{"", "10", "0/1m", "ten/1m", "10/soon", "10/-1s"} {
+		if _, err := ParseLimit(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+// testStore exercises the token bucket behaviour shared by every Store.
+// advance moves the store's clock forward.
+func testStore(t *testing.T, store Store, advance func(time.Duration)) {
+	ctx := context.Background()
+	limit := Limit{Requests: 2, Per: 2 * time.Second}
+
+	// Test case: The bucket starts full and empties
+	t.Run("Burst", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			result, err := store.Take(ctx, "burst", limit)
+			if err != nil {
+				t.Fatalf("Take failed: %v", err)
+			}
+			if !result.Allowed || result.Remaining != 1-i {
+				t.Errorf("Request %d: unexpected result %+v", i, result)
+			}
+		}
+
+		result, _ := store.Take(ctx, "burst", limit)
+		if result.Allowed {
+			t.Error("Expected request beyond the burst to be rejected")
+		}
+		if result.RetryAfter <= 0 || result.RetryAfter > time.Second {
+			t.Errorf("Expected retry within a second, got %v", result.RetryAfter)
+		}
+	})
+
+	// Test case: Tokens come back over time
+	t.Run("Refill", func(t *testing.T) {
+		advance(time.Second)
+
+		result, _ := store.Take(ctx, "burst", limit)
+		if !result.Allowed {
+			t.Errorf("Expected a token after refilling, got %+v", result)
+		}
+	})
+
+	// Test case: Buckets are independent
+	t.Run("Separate keys", func(t *testing.T) {
+		result, _ := store.Take(ctx, "other", limit)
+		if !result.Allowed {
+			t.Error("Expected a fresh bucket for another key")
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	testStore(t, store, func(d time.Duration) { now = now.Add(d) })
+}
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.SetTime(time.Now())
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	testStore(t, NewRedisStore(client, ""), func(d time.Duration) { server.SetTime(time.Now().Add(d)) })
+}
+
+func TestMiddleware(t *testing.T) {
+	// Setup
+	store := NewMemoryStore()
+	handler := Middleware(store, &MockLogger{}, Config{
+		Limits: map[string]Limit{ClassCreate: {Requests: 1, Per: time.Minute}},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(path, remoteAddr, owner string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		req.RemoteAddr = remoteAddr
+		if owner != "" {
+			req = req.WithContext(middleware.WithPrincipal(req.Context(), middleware.Principal{ID: owner}))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Test case: Requests over the limit get 429 with headers
+	t.Run("Limit exceeded", func(t *testing.T) {
+		w := send("/shorturls", "192.0.2.1:1234", "")
+		if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "1" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+			t.Errorf("Unexpected first response: %d %v", w.Code, w.Header())
+		}
+
+		w = send("/shorturls", "192.0.2.1:5678", "")
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expected status code %d, got %d", http.StatusTooManyRequests, w.Code)
+		}
+		if w.Header().Get("Retry-After") != "60" {
+			t.Errorf("Expected Retry-After 60, got %q", w.Header().Get("Retry-After"))
+		}
+	})
+
+	// Test case: Clients are limited separately
+	t.Run("Separate clients", func(t *testing.T) {
+		if w := send("/shorturls", "192.0.2.2:1234", ""); w.Code != http.StatusOK {
+			t.Errorf("Expected another IP to be allowed, got %d", w.Code)
+		}
+		if w := send("/shorturls", "192.0.2.1:1234", "alice"); w.Code != http.StatusOK {
+			t.Errorf("Expected an authenticated client to be allowed, got %d", w.Code)
+		}
+	})
+
+	// Test case: Unlimited route classes pass through
+	t.Run("Unlimited class", func(t *testing.T) {
+		if w := send("/abc", "192.0.2.1:1234", ""); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "" {
+			t.Errorf("Expected redirect to be unlimited, got %d %v", w.Code, w.Header())
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package reputation
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Action decides what happens to links whose destination is flagged
+type Action string
+
+const (
+	// ActionReject refuses to create flagged links and to redirect to
+	// destinations flagged after the link was created
+	ActionReject Action = "reject"
+
+	// ActionWarn creates flagged links but shows a warning page before
+	// redirecting
+	ActionWarn Action = "warn"
+)
+
+// Verdict is the outcome of a reputation check
+type Verdict struct {
+	Malicious bool   `json:"malicious"` // Whether the URL is known to be harmful
+	Threat    string `json:"threat"`    // Kind of threat, e.g. "SOCIAL_ENGINEERING"
+	Source    string `json:"source"`    // Checker that flagged the URL
+}
+
+// URLChecker reports whether a destination URL is known to be malicious
+type URLChecker interface {
+	Check(ctx context.Context, rawURL string) (Verdict, error)
+}
+
+// CheckerFunc adapts an ordinary function to the URLChecker interface
+type CheckerFunc func(ctx context.Context, rawURL string) (Verdict, error)
+
+// Check calls f(ctx, rawURL)
+func (f CheckerFunc) Check(ctx context.Context, rawURL string) (Verdict, error) {
+	return f(ctx, rawURL)
+}
+
+// VerdictCache is implemented by checkers that can answer from memory,
+// without a lookup that may be slow or fail
+type VerdictCache interface {
+	// Cached returns the remembered verdict for rawURL, if it is still fresh
+	Cached(rawURL string) (Verdict, bool)
+}
+
+// MultiChecker consults several checkers in order and returns the first
+// malicious verdict
+type MultiChecker []URLChecker
+
+// Check runs every checker until one flags rawURL. Errors are returned only
+// if no checker flagged the URL.
+func (m MultiChecker) Check(ctx context.Context, rawURL string) (Verdict, error) {
+	var errs []error
+	for _, checker := range m {
+		verdict, err := checker.Check(ctx, rawURL)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if verdict.Malicious {
+			return verdict, nil
+		}
+	}
+	return Verdict{}, errors.Join(errs...)
+}
+
+// cacheSweepEvery is how many stores pass between removals of stale entries
+const cacheSweepEvery = 256
+
+// cacheEntry is a remembered verdict
+type cacheEntry struct {
+	verdict Verdict
+	expires time.Time
+}
+
+// CachingChecker remembers the verdicts of another checker for a while, so
+// redirects can consult them without a lookup of their own
+type CachingChecker struct {
+	next URLChecker
+	ttl  time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]cacheEntry
+	stores  int
+	now     func() time.Time
+}
+
+// NewCachingChecker creates a CachingChecker that keeps the verdicts of
+// next for ttl
+func NewCachingChecker(next URLChecker, ttl time.Duration) *CachingChecker {
+	return &CachingChecker{
+		next:    next,
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// Check returns the cached verdict for rawURL or asks the wrapped checker.
+// Failed checks are not cached.
+func (c *CachingChecker) Check(ctx context.Context, rawURL string) (Verdict, error) {
+	if verdict, ok := c.Cached(rawURL); ok {
+		return verdict, nil
+	}
+
+	verdict, err := c.next.Check(ctx, rawURL)
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := c.now()
+	c.entries[rawURL] = cacheEntry{verdict: verdict, expires: now.Add(c.ttl)}
+	c.stores++
+	if c.stores%cacheSweepEvery == 0 {
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+	}
+	return verdict, nil
+}
+
+// Cached returns the remembered verdict for rawURL, if it is still fresh
+func (c *CachingChecker) Cached(rawURL string) (Verdict, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[rawURL]
+	if !ok || c.now().After(entry.expires) {
+		return Verdict{}, false
+	}
+	return entry.verdict, true
+}
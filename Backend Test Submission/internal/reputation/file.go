@@ -0,0 +1,70 @@
+package reputation
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// FileChecker flags URLs listed in a local blocklist file
+type FileChecker struct {
+	hosts    []string
+	prefixes []string
+}
+
+// LoadFileChecker reads a blocklist with one entry per line. Entries
+// containing "://" block every URL starting with them; other entries block
+// a host and its subdomains. Blank lines and lines starting with # are
+// ignored.
+func LoadFileChecker(path string) (*FileChecker, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open URL blocklist: %w", err)
+	}
+	defer file.Close()
+
+	c := &FileChecker{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.Contains(line, "://") {
+			c.prefixes = append(c.prefixes, strings.ToLower(line))
+		} else {
+			c.hosts = append(c.hosts, strings.TrimSuffix(strings.ToLower(line), "."))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read URL blocklist: %w", err)
+	}
+	return c, nil
+}
+
+// Check flags rawURL if its host or a prefix of it is on the blocklist
+func (c *FileChecker) Check(_ context.Context, rawURL string) (Verdict, error) {
+	flagged := Verdict{Malicious: true, Threat: "BLOCKLISTED", Source: "blocklist"}
+
+	lower := strings.ToLower(rawURL)
+	for _, prefix := range c.prefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return flagged, nil
+		}
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Verdict{}, nil
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for _, blocked := range c.hosts {
+		if host == blocked || strings.HasSuffix(host, "."+blocked) {
+			return flagged, nil
+		}
+	}
+	return Verdict{}, nil
+}
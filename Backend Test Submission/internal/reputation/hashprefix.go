@@ -0,0 +1,177 @@
+package reputation
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// hashPrefixLength is how many bytes of each hash are sent to the server,
+// so that the lookup does not reveal which URL is being checked
+const hashPrefixLength = 4
+
+// HashPrefixConfig configures a HashPrefixClient
+type HashPrefixConfig struct {
+	// Endpoint receives the lookup requests
+	Endpoint string
+
+	// APIKey, if set, is sent as the key query parameter
+	APIKey string
+
+	// Client performs the requests (defaults to a client with a 5s timeout)
+	Client *http.Client
+}
+
+// HashPrefixClient checks URLs against a Safe-Browsing-style lookup service.
+// It hashes a set of host and path expressions of the URL and sends only
+// the first bytes of each hash; the server answers with the full hashes it
+// knows that share a prefix, and the client compares them locally.
+//
+// Request:  {"prefixes": ["<hex prefix>", ...]}
+// Response: {"matches": [{"hash": "<hex sha256>", "threat": "MALWARE"}]}
+type HashPrefixClient struct {
+	config HashPrefixConfig
+}
+
+// NewHashPrefixClient creates a HashPrefixClient for config
+func NewHashPrefixClient(config HashPrefixConfig) *HashPrefixClient {
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	return &HashPrefixClient{config: config}
+}
+
+// hashPrefixRequest is the body of a lookup request
+type hashPrefixRequest struct {
+	Prefixes []string `json:"prefixes"`
+}
+
+// hashPrefixResponse is the body of a lookup response
+type hashPrefixResponse struct {
+	Matches []struct {
+		Hash   string `json:"hash"`
+		Threat string `json:"threat"`
+	} `json:"matches"`
+}
+
+// Check looks rawURL up with the service
+func (c *HashPrefixClient) Check(ctx context.Context, rawURL string) (Verdict, error) {
+	expressions := URLExpressions(rawURL)
+	if len(expressions) == 0 {
+		return Verdict{}, nil
+	}
+
+	full := make(map[string]bool, len(expressions))
+	prefixes := make(map[string]bool, len(expressions))
+	for _, expression := range expressions {
+		sum := sha256.Sum256([]byte(expression))
+		full[hex.EncodeToString(sum[:])] = true
+		prefixes[hex.EncodeToString(sum[:hashPrefixLength])] = true
+	}
+
+	var body hashPrefixRequest
+	for prefix := range prefixes {
+		body.Prefixes = append(body.Prefixes, prefix)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	endpoint := c.config.Endpoint
+	if c.config.APIKey != "" {
+		endpoint += "?key=" + url.QueryEscape(c.config.APIKey)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.config.Client.Do(req)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("reputation lookup: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("reputation lookup: unexpected status %s", resp.Status)
+	}
+
+	var result hashPrefixResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Verdict{}, fmt.Errorf("reputation lookup: decode response: %w", err)
+	}
+	for _, match := range result.Matches {
+		if full[strings.ToLower(match.Hash)] {
+			return Verdict{Malicious: true, Threat: match.Threat, Source: "lookup"}, nil
+		}
+	}
+	return Verdict{}, nil
+}
+
+// URLExpressions returns the host suffix and path prefix combinations under
+// which a URL is looked up, e.g. for http://a.b.example.com/1/2?x=y:
+//
+//	a.b.example.com/1/2?x=y, a.b.example.com/1/2, a.b.example.com/1/, a.b.example.com/,
+//	b.example.com/1/2?x=y, ..., example.com/
+//
+// Lookup services hash the same expressions of the URLs they list.
+func URLExpressions(rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	hosts := []string{host}
+	if labels := strings.Split(host, "."); len(labels) > 2 && net.ParseIP(host) == nil {
+		// At most four additional suffixes, starting from the last five labels
+		start := len(labels) - 5
+		if start < 1 {
+			start = 1
+		}
+		for i := start; i <= len(labels)-2; i++ {
+			hosts = append(hosts, strings.Join(labels[i:], "."))
+		}
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	var paths []string
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := len(segments) - 1; i >= 0 && len(paths) < 6; i-- {
+		prefix := "/" + strings.Join(segments[:i], "/")
+		if i > 0 {
+			prefix += "/"
+		}
+		if prefix != path {
+			paths = append(paths, prefix)
+		}
+	}
+
+	var expressions []string
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		for _, p := range paths {
+			if expression := h + p; !seen[expression] {
+				seen[expression] = true
+				expressions = append(expressions, expression)
+			}
+		}
+	}
+	return expressions
+}
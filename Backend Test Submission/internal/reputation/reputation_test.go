@@ -0,0 +1,175 @@
+package reputation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileChecker(t *testing.T) {
+	// Setup
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	content := "# Known phishing\nphish.example\nhttps://files.example/malware/\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write blocklist: %v", err)
+	}
+	checker, err := LoadFileChecker(path)
+	if err != nil {
+		t.Fatalf("Failed to load blocklist: %v", err)
+	}
+
+	tests := map[string]bool{
+		"https://phish.example/login":         true,
+		"https://login.PHISH.example/":        true,
+		"https://files.example/malware/x.exe": true,
+		"https://files.example/docs/":         false,
+		"https://example.com/":                false,
+	}
+	for rawURL, malicious := range tests {
+		verdict, err := checker.Check(context.Background(), rawURL)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		if verdict.Malicious != malicious {
+			t.Errorf("%s: expected malicious=%v, got %+v", rawURL, malicious, verdict)
+		}
+	}
+}
+
+func TestURLExpressions(t *testing.T) {
+	expressions := URLExpressions("http://a.b.example.com/1/2?x=y")
+	for _, expected := range []string{
+		"a.b.example.com/1/2?x=y",
+		"a.b.example.com/1/2",
+		"a.b.example.com/1/",
+		"a.b.example.com/",
+		"b.example.com/1/2",
+		"example.com/",
+	} {
+		found := false
+		for _, expression := range expressions {
+			found = found || expression == expected
+		}
+		if !found {
+			t.Errorf("Expected expression %s in %v", expected, expressions)
+		}
+	}
+}
+
+func TestHashPrefixClient(t *testing.T) {
+	// Setup: a stand-in lookup server listing one host
+	listed := sha256.Sum256([]byte("evil.example/"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "test-key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var req hashPrefixRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var resp hashPrefixResponse
+		for _, prefix := range req.Prefixes {
+			if len(prefix) != 2*hashPrefixLength {
+				t.Errorf("Expected %d byte prefixes, got %s", hashPrefixLength, prefix)
+			}
+			if strings.HasPrefix(hex.EncodeToString(listed[:]), prefix) {
+				resp.Matches = append(resp.Matches, struct {
+					Hash   string `json:"hash"`
+					Threat string `json:"threat"`
+				}{hex.EncodeToString(listed[:]), "SOCIAL_ENGINEERING"})
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewHashPrefixClient(HashPrefixConfig{Endpoint: server.URL, APIKey: "test-key"})
+
+	// Test case: Listed host is flagged through a path prefix expression
+	t.Run("Listed URL", func(t *testing.T) {
+		verdict, err := client.Check(context.Background(), "https://login.evil.example/account?id=1")
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		if !verdict.Malicious || verdict.Threat != "SOCIAL_ENGINEERING" {
+			t.Errorf("Expected URL to be flagged, got %+v", verdict)
+		}
+	})
+
+	// Test case: Other URLs are clean
+	t.Run("Clean URL", func(t *testing.T) {
+		verdict, err := client.Check(context.Background(), "https://example.com/")
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		if verdict.Malicious {
+			t.Errorf("Expected URL to be clean, got %+v", verdict)
+		}
+	})
+
+	// Test case: Server errors are reported
+	t.Run("Server error", func(t *testing.T) {
+		failing := NewHashPrefixClient(HashPrefixConfig{Endpoint: server.URL})
+		if _, err := failing.Check(context.Background(), "https://example.com/"); err == nil {
+			t.Error("Expected error for rejected lookup")
+		}
+	})
+}
+
+func TestCachingChecker(t *testing.T) {
+	// Setup
+	calls := 0
+	fail := false
+	checker := NewCachingChecker(CheckerFunc(func(ctx context.Context, rawURL string) (Verdict, error) {
+		calls++
+		if fail {
+			return Verdict{}, errors.New("lookup failed")
+		}
+		return Verdict{Malicious: true, Source: "test"}, nil
+	}), time.Minute)
+	now := time.Now()
+	checker.now = func() time.Time { return now }
+
+	// Test case: Verdicts are cached
+	t.Run("Cache hit", func(t *testing.T) {
+		if _, ok := checker.Cached("https://example.com/"); ok {
+			t.Fatal("Expected empty cache")
+		}
+		checker.Check(context.Background(), "https://example.com/")
+		checker.Check(context.Background(), "https://example.com/")
+		if calls != 1 {
+			t.Errorf("Expected 1 lookup, got %d", calls)
+		}
+		if verdict, ok := checker.Cached("https://example.com/"); !ok || !verdict.Malicious {
+			t.Errorf("Expected cached malicious verdict, got %+v (%v)", verdict, ok)
+		}
+	})
+
+	// Test case: Verdicts expire and failures are not cached
+	t.Run("Expiry", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+		fail = true
+		if _, ok := checker.Cached("https://example.com/"); ok {
+			t.Error("Expected stale verdict to be ignored")
+		}
+		if _, err := checker.Check(context.Background(), "https://example.com/"); err == nil {
+			t.Error("Expected lookup error")
+		}
+		if _, ok := checker.Cached("https://example.com/"); ok {
+			t.Error("Expected failed lookup not to be cached")
+		}
+	})
+}
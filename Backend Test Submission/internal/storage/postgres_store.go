@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	// Register the PostgreSQL driver
+	_ "github.com/lib/pq"
+)
+
+// postgresDialect describes the PostgreSQL schema and query syntax
+var postgresDialect = sqlDialect{
+	positional: true,
+
+	// Serialize migrations across replicas starting at the same time; the
+	// lock is released when the migration transaction ends
+	lockStatement: `SELECT pg_advisory_xact_lock(72170467)`,
+
+	migrations: []string{
+		`CREATE TABLE short_urls (
+			id           TEXT PRIMARY KEY,
+			original_url TEXT NOT NULL,
+			created_at   TIMESTAMPTZ NOT NULL,
+			expires_at   TIMESTAMPTZ NOT NULL,
+			clicks       BIGINT NOT NULL DEFAULT 0
+		);
+		CREATE TABLE clicks (
+			id         BIGSERIAL PRIMARY KEY,
+			shortcode  TEXT NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			timestamp  TIMESTAMPTZ NOT NULL,
+			referrer   TEXT NOT NULL DEFAULT '',
+			location   TEXT NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX idx_clicks_shortcode ON clicks(shortcode);`,
+		`ALTER TABLE short_urls ADD COLUMN owner TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE short_urls ADD COLUMN preview BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE short_urls ADD COLUMN redirect_type INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE short_urls ADD COLUMN password_hash TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE short_urls ADD COLUMN max_clicks INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE short_urls ADD COLUMN activates_at TIMESTAMPTZ`,
+		`ALTER TABLE short_urls ADD COLUMN fallback_url TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE short_urls ADD COLUMN redirect_rules TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE clicks ADD COLUMN matched_rule INTEGER`,
+		`ALTER TABLE short_urls ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT FALSE`,
+	},
+}
+
+// PostgresURLStore implements URLStore on top of a PostgreSQL database
+type PostgresURLStore struct {
+	*sqlURLStore
+}
+
+// NewPostgresURLStore connects to the database described by dsn and
+// applies any pending schema migrations
+func NewPostgresURLStore(dsn string) (*PostgresURLStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open postgres database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect to postgres: %w", err)
+	}
+
+	store, err := newSQLURLStore(db, postgresDialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &PostgresURLStore{store}, nil
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"12217467/backend_test_submission/internal/models"
+)
+
+// openTestPostgres connects to the database named by POSTGRES_TEST_DSN,
+// skipping the test when it is not set
+func openTestPostgres(t *testing.T) *PostgresURLStore {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set; skipping PostgreSQL tests")
+	}
+
+	store, err := NewPostgresURLStore(dsn)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	return store
+}
+
+func TestPostgresURLStore(t *testing.T) {
+	store := openTestPostgres(t)
+	defer store.Close()
+
+	testURLStore(t, store, fmt.Sprintf("t%d", time.Now().UnixNano()%1e6))
+}
+
+func TestPostgresURLStoreConcurrentCreate(t *testing.T) {
+	ctx := context.Background()
+	store := openTestPostgres(t)
+	defer store.Close()
+
+	// Setup
+	now := time.Now()
+	shortURL := models.ShortURL{
+		ID:          fmt.Sprintf("race%d", now.UnixNano()%1e6),
+		OriginalURL: "https://example.com",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(30 * time.Minute),
+	}
+	defer store.Delete(ctx, shortURL.ID)
+
+	// Race several writers for the same shortcode
+	const writers = 10
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- store.Create(ctx, shortURL)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			created++
+		case ErrShortcodeExists:
+		default:
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("Expected exactly 1 successful create, got %d", created)
+	}
+}
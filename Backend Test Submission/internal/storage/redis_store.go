@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"12217467/backend_test_submission/internal/models"
+)
+
+// DefaultRedisKeyPrefix is prepended to every key written by RedisURLStore
+const DefaultRedisKeyPrefix = "shorturl:"
+
+// RedisStoreConfig configures a RedisURLStore
+type RedisStoreConfig struct {
+	// KeyPrefix namespaces the store's keys (defaults to DefaultRedisKeyPrefix)
+	KeyPrefix string
+
+	// ExpiredRetention keeps records around for this long after ExpiresAt so
+	// lookups can report ErrShortcodeExpired instead of ErrShortcodeNotFound.
+	// Once it elapses Redis evicts the keys on its own.
+	ExpiredRetention time.Duration
+}
+
+// Lua scripts keep multi-key operations atomic. All keys of one short URL
+// share a {shortcode} hash tag so the scripts also work on Redis Cluster.
+var (
+	// redisCreateScript inserts the record only if the shortcode is free and
+	// clears click keys left behind by a previous owner of the code
+	redisCreateScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PXAT', ARGV[2]) then
+	redis.call('DEL', KEYS[2], KEYS[3])
+	return 1
+end
+return 0`)
+
+	// redisUpdateScript replaces an existing record and moves every key of
+	// the short URL to the new expiry
+	redisUpdateScript = redis.NewScript(`
+local record = redis.call('GET', KEYS[1])
+if not record or cjson.decode(record).deleted then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PXAT', ARGV[2])
+redis.call('PEXPIREAT', KEYS[2], ARGV[2])
+redis.call('PEXPIREAT', KEYS[3], ARGV[2])
+return 1`)
+
+	// redisDeleteScript replaces a live record with the tombstone and drops
+	// its click keys
+	redisDeleteScript = redis.NewScript(`
+local record = redis.call('GET', KEYS[1])
+if not record or cjson.decode(record).deleted then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PXAT', ARGV[2])
+redis.call('DEL', KEYS[2], KEYS[3])
+return 1`)
+
+	// redisClickScript increments the counter and appends the click, giving
+	// both keys the same lifetime as the record. It refuses the click with
+	// -1 once the record's click limit is reached, and with -2 if the
+	// record has been deleted.
+	redisClickScript = redis.NewScript(`
+local record = redis.call('GET', KEYS[1])
+if not record then
+	return 0
+end
+local data = cjson.decode(record)
+if data.deleted then
+	return -2
+end
+local maxClicks = tonumber(data.maxClicks) or 0
+if maxClicks > 0 and (tonumber(redis.call('GET', KEYS[2])) or 0) >= maxClicks then
+	return -1
+end
+local ttl = redis.call('PTTL', KEYS[1])
+redis.call('INCR', KEYS[2])
+redis.call('RPUSH', KEYS[3], ARGV[1])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[2], ttl)
+	redis.call('PEXPIRE', KEYS[3], ttl)
+end
+return 1`)
+)
+
+// RedisURLStore implements URLStore on a Redis-protocol server so several
+// service instances can share one view of the shortcodes. Each short URL is
+// kept under three keys: the JSON record, an INCR click counter and a list
+// of click events, all expiring together via key TTLs.
+type RedisURLStore struct {
+	client redis.UniversalClient
+	config RedisStoreConfig
+}
+
+// NewRedisURLStore creates a RedisURLStore using client
+func NewRedisURLStore(client redis.UniversalClient, config RedisStoreConfig) *RedisURLStore {
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = DefaultRedisKeyPrefix
+	}
+	return &RedisURLStore{
+		client: client,
+		config: config,
+	}
+}
+
+// Close closes the underlying Redis client
+func (s *RedisURLStore) Close() error {
+	return s.client.Close()
+}
+
+// keys returns the record, click counter and click list keys for shortcode
+func (s *RedisURLStore) keys(shortcode string) []string {
+	base := s.config.KeyPrefix + "{" + shortcode + "}"
+	return []string{base, base + ":clicks", base + ":clickdata"}
+}
+
+// evictAt returns the Unix millisecond timestamp at which Redis should drop
+// the keys of shortURL. Links with a fallback are kept until they are
+// deleted, since their fallback is served after expiry.
+func (s *RedisURLStore) evictAt(shortURL models.ShortURL) int64 {
+	if shortURL.FallbackURL != "" {
+		return models.NeverExpires.UnixMilli()
+	}
+	return shortURL.ExpiresAt.Add(s.config.ExpiredRetention).UnixMilli()
+}
+
+// encodeRedisRecord serializes the record without its click data, which
+// lives in separate keys
+func encodeRedisRecord(shortURL models.ShortURL) (string, error) {
+	shortURL.Clicks = 0
+	shortURL.ClickData = nil
+	data, err := json.Marshal(shortURL)
+	return string(data), err
+}
+
+// Create stores a new short URL
+func (s *RedisURLStore) Create(ctx context.Context, shortURL models.ShortURL) error {
+	record, err := encodeRedisRecord(shortURL)
+	if err != nil {
+		return err
+	}
+
+	created, err := redisCreateScript.Run(ctx, s.client, s.keys(shortURL.ID), record, s.evictAt(shortURL)).Int()
+	if err != nil {
+		return err
+	}
+	if created == 0 {
+		return ErrShortcodeExists
+	}
+	return nil
+}
+
+// Get retrieves a short URL by its shortcode
+func (s *RedisURLStore) Get(ctx context.Context, shortcode string) (models.ShortURL, error) {
+	keys := s.keys(shortcode)
+
+	var record, clicks *redis.StringCmd
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		record = pipe.Get(ctx, keys[0])
+		clicks = pipe.Get(ctx, keys[1])
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return models.ShortURL{}, err
+	}
+
+	data, err := record.Bytes()
+	if errors.Is(err, redis.Nil) {
+		return models.ShortURL{}, ErrShortcodeNotFound
+	}
+	if err != nil {
+		return models.ShortURL{}, err
+	}
+
+	var shortURL models.ShortURL
+	if err := json.Unmarshal(data, &shortURL); err != nil {
+		return models.ShortURL{}, err
+	}
+	if shortURL.Deleted {
+		return shortURL, ErrShortcodeDeleted
+	}
+
+	// Check if the URL has expired
+	if time.Now().After(shortURL.ExpiresAt) {
+		return shortURL, ErrShortcodeExpired
+	}
+
+	if n, err := clicks.Int(); err == nil {
+		shortURL.Clicks = n
+	}
+
+	return shortURL, activationError(shortURL)
+}
+
+// ListClicks returns the click events of a short URL
+func (s *RedisURLStore) ListClicks(ctx context.Context, shortcode string) ([]models.Click, error) {
+	events, err := s.client.LRange(ctx, s.keys(shortcode)[2], 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	clicks := make([]models.Click, 0, len(events))
+	for _, raw := range events {
+		var click models.Click
+		if err := json.Unmarshal([]byte(raw), &click); err != nil {
+			return nil, err
+		}
+		clicks = append(clicks, click)
+	}
+	return clicks, nil
+}
+
+// Update updates an existing short URL. Click counters are owned by
+// RecordClick and are left untouched.
+func (s *RedisURLStore) Update(ctx context.Context, shortURL models.ShortURL) error {
+	record, err := encodeRedisRecord(shortURL)
+	if err != nil {
+		return err
+	}
+
+	updated, err := redisUpdateScript.Run(ctx, s.client, s.keys(shortURL.ID), record, s.evictAt(shortURL)).Int()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrShortcodeNotFound
+	}
+	return nil
+}
+
+// Delete replaces a short URL with a tombstone, which Redis evicts when the
+// record itself would have been
+func (s *RedisURLStore) Delete(ctx context.Context, shortcode string) error {
+	keys := s.keys(shortcode)
+
+	data, err := s.client.Get(ctx, keys[0]).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ErrShortcodeNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var shortURL models.ShortURL
+	if err := json.Unmarshal(data, &shortURL); err != nil {
+		return err
+	}
+	deleted := tombstone(shortURL)
+	record, err := encodeRedisRecord(deleted)
+	if err != nil {
+		return err
+	}
+
+	n, err := redisDeleteScript.Run(ctx, s.client, keys, record, s.evictAt(deleted)).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrShortcodeNotFound
+	}
+	return nil
+}
+
+// RecordClick records a click event for a shortcode
+func (s *RedisURLStore) RecordClick(ctx context.Context, shortcode string, click models.Click) error {
+	keys := s.keys(shortcode)
+
+	data, err := s.client.Get(ctx, keys[0]).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ErrShortcodeNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var shortURL models.ShortURL
+	if err := json.Unmarshal(data, &shortURL); err != nil {
+		return err
+	}
+	if shortURL.Deleted {
+		return ErrShortcodeDeleted
+	}
+
+	// Check if the URL has expired
+	if time.Now().After(shortURL.ExpiresAt) {
+		return ErrShortcodeExpired
+	}
+	if err := activationError(shortURL); err != nil {
+		return err
+	}
+
+	event, err := json.Marshal(click)
+	if err != nil {
+		return err
+	}
+
+	recorded, err := redisClickScript.Run(ctx, s.client, keys, event).Int()
+	if err != nil {
+		return err
+	}
+	switch recorded {
+	case 0:
+		return ErrShortcodeNotFound
+	case -1:
+		return ErrClickLimitReached
+	case -2:
+		return ErrShortcodeDeleted
+	}
+	return nil
+}
+
+// ShortcodeExists checks if a shortcode already exists
+func (s *RedisURLStore) ShortcodeExists(ctx context.Context, shortcode string) bool {
+	n, err := s.client.Exists(ctx, s.keys(shortcode)[0]).Result()
+	return err == nil && n > 0
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"12217467/backend_test_submission/internal/models"
+)
+
+// newTestRedisStore starts an in-process Redis stand-in and returns a store
+// connected to it
+func newTestRedisStore(t *testing.T, config RedisStoreConfig) (*RedisURLStore, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	store := NewRedisURLStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), config)
+	t.Cleanup(func() { store.Close() })
+	return store, server
+}
+
+func TestRedisURLStore(t *testing.T) {
+	store, _ := newTestRedisStore(t, RedisStoreConfig{ExpiredRetention: time.Hour})
+
+	testURLStore(t, store, "")
+}
+
+func TestRedisURLStoreTTL(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	store, server := newTestRedisStore(t, RedisStoreConfig{})
+	now := time.Now()
+	shortURL := models.ShortURL{
+		ID:          "ttl",
+		OriginalURL: "https://example.com",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Minute),
+	}
+	if err := store.Create(ctx, shortURL); err != nil {
+		t.Fatalf("Failed to create short URL: %v", err)
+	}
+	if err := store.RecordClick(ctx, shortURL.ID, models.Click{Timestamp: now}); err != nil {
+		t.Fatalf("Failed to record click: %v", err)
+	}
+
+	// Test case: Every key carries the record's expiry
+	t.Run("Keys expire with the record", func(t *testing.T) {
+		for _, key := range store.keys(shortURL.ID) {
+			if ttl := server.TTL(key); ttl <= 0 || ttl > time.Minute {
+				t.Errorf("Expected TTL within a minute for %s, got %v", key, ttl)
+			}
+		}
+	})
+
+	// Test case: Clicks use an atomic counter
+	t.Run("Click counter", func(t *testing.T) {
+		counter, err := server.Get(store.keys(shortURL.ID)[1])
+		if err != nil || counter != "1" {
+			t.Errorf("Expected click counter 1, got %q (%v)", counter, err)
+		}
+	})
+
+	// Test case: Links with a fallback are not evicted
+	t.Run("Fallback kept", func(t *testing.T) {
+		fallback := shortURL
+		fallback.ID = "fallback"
+		fallback.FallbackURL = "https://example.com/expired"
+		if err := store.Create(ctx, fallback); err != nil {
+			t.Fatalf("Failed to create short URL: %v", err)
+		}
+		defer store.Delete(ctx, fallback.ID)
+
+		server.FastForward(24 * time.Hour)
+		if !store.ShortcodeExists(ctx, fallback.ID) {
+			t.Error("Expected link with a fallback to be kept")
+		}
+	})
+
+	// Test case: Redis evicts the record once its TTL elapses
+	t.Run("Eviction", func(t *testing.T) {
+		server.FastForward(2 * time.Minute)
+
+		if _, err := store.Get(ctx, shortURL.ID); err != ErrShortcodeNotFound {
+			t.Errorf("Expected %v, got %v", ErrShortcodeNotFound, err)
+		}
+	})
+}
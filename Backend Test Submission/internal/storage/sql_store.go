@@ -0,0 +1,461 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"12217467/backend_test_submission/internal/models"
+)
+
+// sqlDialect captures the differences between the SQL databases supported
+// by sqlURLStore
+type sqlDialect struct {
+	// positional reports whether placeholders are numbered ($1, $2, ...)
+	// rather than written as ?
+	positional bool
+
+	// lockStatement, if set, runs at the start of the migration transaction
+	// so that several instances starting at once migrate one at a time
+	lockStatement string
+
+	// migrations lists the schema changes applied on startup, in order.
+	// Entries must never be edited once released; append new ones instead.
+	migrations []string
+}
+
+// shortURLColumns lists the short_urls columns read by scanShortURL, in order
+const shortURLColumns = `id, original_url, created_at, expires_at, clicks, owner, preview, redirect_type, password_hash, max_clicks, activates_at, fallback_url, redirect_rules, deleted`
+
+// sqlURLStore implements URLStore on top of database/sql. Short URLs live
+// in the short_urls table and click events in a separate clicks table.
+type sqlURLStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+// newSQLURLStore wraps db and applies any pending schema migrations
+func newSQLURLStore(db *sql.DB, dialect sqlDialect) (*sqlURLStore, error) {
+	s := &sqlURLStore{db: db, dialect: dialect}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// rebind rewrites ? placeholders into the dialect's native form
+func (s *sqlURLStore) rebind(query string) string {
+	if !s.dialect.positional {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// migrate applies every migration that has not been recorded yet
+func (s *sqlURLStore) migrate() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin migrations: %w", err)
+	}
+	defer tx.Rollback()
+
+	if s.dialect.lockStatement != "" {
+		if _, err := tx.Exec(s.dialect.lockStatement); err != nil {
+			return fmt.Errorf("lock migrations: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations table: %w", err)
+	}
+
+	var current int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	for i := current; i < len(s.dialect.migrations); i++ {
+		version := i + 1
+		if _, err := tx.Exec(s.dialect.migrations[i]); err != nil {
+			return fmt.Errorf("apply migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(s.rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`), version, time.Now().UTC()); err != nil {
+			return fmt.Errorf("record migration %d: %w", version, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migrations: %w", err)
+	}
+	return nil
+}
+
+// Close releases the underlying database handle
+func (s *sqlURLStore) Close() error {
+	return s.db.Close()
+}
+
+// Create stores a new short URL
+func (s *sqlURLStore) Create(ctx context.Context, shortURL models.ShortURL) error {
+	rules, err := encodeRules(shortURL.RedirectRules)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, s.rebind(
+		`INSERT INTO short_urls (id, original_url, created_at, expires_at, clicks, owner, preview, redirect_type, password_hash, max_clicks, activates_at, fallback_url, redirect_rules)
+		 VALUES (?, ?, ?, ?, 0, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (id) DO NOTHING`),
+		shortURL.ID, shortURL.OriginalURL, shortURL.CreatedAt.UTC(), shortURL.ExpiresAt.UTC(), shortURL.Owner,
+		shortURL.Preview, shortURL.RedirectType, shortURL.PasswordHash, shortURL.MaxClicks, nullTime(shortURL.ActivatesAt),
+		shortURL.FallbackURL, rules,
+	)
+	if err != nil {
+		return err
+	}
+
+	// The primary key makes the insert atomic; zero affected rows means
+	// another writer already owns the shortcode
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrShortcodeExists
+	}
+
+	return nil
+}
+
+// Get retrieves a short URL by its shortcode
+func (s *sqlURLStore) Get(ctx context.Context, shortcode string) (models.ShortURL, error) {
+	shortURL, err := scanShortURL(s.db.QueryRowContext(ctx, s.rebind(
+		`SELECT `+shortURLColumns+` FROM short_urls WHERE id = ?`),
+		shortcode,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ShortURL{}, ErrShortcodeNotFound
+	}
+	if err != nil {
+		return models.ShortURL{}, err
+	}
+	if shortURL.Deleted {
+		return shortURL, ErrShortcodeDeleted
+	}
+
+	// Check if the URL has expired
+	if time.Now().After(shortURL.ExpiresAt) {
+		return shortURL, ErrShortcodeExpired
+	}
+
+	return shortURL, activationError(shortURL)
+}
+
+// ListClicks returns the click events of a short URL
+func (s *sqlURLStore) ListClicks(ctx context.Context, shortcode string) ([]models.Click, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(
+		`SELECT timestamp, referrer, location, user_agent, matched_rule FROM clicks WHERE shortcode = ? ORDER BY id`),
+		shortcode,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clicks := []models.Click{}
+	for rows.Next() {
+		var click models.Click
+		var matchedRule sql.NullInt64
+		if err := rows.Scan(&click.Timestamp, &click.Referrer, &click.Location, &click.UserAgent, &matchedRule); err != nil {
+			return nil, err
+		}
+		click.MatchedRule = optionalInt(matchedRule)
+		clicks = append(clicks, click)
+	}
+	return clicks, rows.Err()
+}
+
+// Update updates an existing short URL. Click counters are owned by
+// RecordClick and are left untouched.
+func (s *sqlURLStore) Update(ctx context.Context, shortURL models.ShortURL) error {
+	rules, err := encodeRules(shortURL.RedirectRules)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, s.rebind(
+		`UPDATE short_urls SET original_url = ?, created_at = ?, expires_at = ?, preview = ?, redirect_type = ?,
+		 password_hash = ?, max_clicks = ?, activates_at = ?, fallback_url = ?, redirect_rules = ? WHERE id = ? AND NOT deleted`),
+		shortURL.OriginalURL, shortURL.CreatedAt.UTC(), shortURL.ExpiresAt.UTC(), shortURL.Preview, shortURL.RedirectType,
+		shortURL.PasswordHash, shortURL.MaxClicks, nullTime(shortURL.ActivatesAt), shortURL.FallbackURL, rules, shortURL.ID,
+	)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// Delete replaces a short URL with a tombstone, clearing everything but
+// its shortcode, owner and lifetime, and removes its click history
+func (s *sqlURLStore) Delete(ctx context.Context, shortcode string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, s.rebind(
+		`UPDATE short_urls SET original_url = '', clicks = 0, preview = FALSE, redirect_type = 0, password_hash = '', max_clicks = 0,
+		 activates_at = NULL, fallback_url = '', redirect_rules = '', deleted = TRUE WHERE id = ? AND NOT deleted`), shortcode)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(res); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM clicks WHERE shortcode = ?`), shortcode); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecordClick records a click event for a shortcode. The click limit is
+// checked by the counter update itself, so concurrent clicks cannot
+// overshoot it.
+func (s *sqlURLStore) RecordClick(ctx context.Context, shortcode string, click models.Click) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var expiresAt time.Time
+	var activatesAt sql.NullTime
+	var deleted bool
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT expires_at, activates_at, deleted FROM short_urls WHERE id = ?`), shortcode).Scan(&expiresAt, &activatesAt, &deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrShortcodeNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if deleted {
+		return ErrShortcodeDeleted
+	}
+
+	// Check if the URL has expired
+	if time.Now().After(expiresAt) {
+		return ErrShortcodeExpired
+	}
+	if activatesAt.Valid && time.Now().Before(activatesAt.Time) {
+		return ErrShortcodeNotActive
+	}
+
+	res, err := tx.ExecContext(ctx, s.rebind(
+		`UPDATE short_urls SET clicks = clicks + 1 WHERE id = ? AND (max_clicks = 0 OR clicks < max_clicks)`), shortcode)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrClickLimitReached
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(
+		`INSERT INTO clicks (shortcode, timestamp, referrer, location, user_agent, matched_rule) VALUES (?, ?, ?, ?, ?, ?)`),
+		shortcode, click.Timestamp.UTC(), click.Referrer, click.Location, click.UserAgent, nullInt(click.MatchedRule),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ShortcodeExists checks if a shortcode already exists
+func (s *sqlURLStore) ShortcodeExists(ctx context.Context, shortcode string) bool {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT EXISTS (SELECT 1 FROM short_urls WHERE id = ?)`), shortcode).Scan(&exists)
+	return err == nil && exists
+}
+
+// PurgeExpired removes every short URL without a fallback that expired
+// before cutoff. Click events are removed with them by the foreign key
+// cascade.
+func (s *sqlURLStore) PurgeExpired(ctx context.Context, cutoff time.Time, archive func([]models.ShortURL) error) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if archive != nil {
+		expired, err := s.loadExpired(ctx, tx, cutoff)
+		if err != nil {
+			return 0, err
+		}
+		if len(expired) == 0 {
+			return 0, nil
+		}
+		if err := archive(expired); err != nil {
+			return 0, err
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM short_urls WHERE expires_at < ? AND fallback_url = ''`), cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(purged), tx.Commit()
+}
+
+// loadExpired reads the short URLs PurgeExpired removes together with their
+// click events
+func (s *sqlURLStore) loadExpired(ctx context.Context, tx *sql.Tx, cutoff time.Time) ([]models.ShortURL, error) {
+	rows, err := tx.QueryContext(ctx, s.rebind(
+		`SELECT `+shortURLColumns+` FROM short_urls WHERE expires_at < ? AND fallback_url = '' ORDER BY id`),
+		cutoff.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []models.ShortURL
+	index := make(map[string]int)
+	for rows.Next() {
+		shortURL, err := scanShortURL(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		shortURL.ClickData = []models.Click{}
+		index[shortURL.ID] = len(expired)
+		expired = append(expired, shortURL)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, s.rebind(
+		`SELECT c.shortcode, c.timestamp, c.referrer, c.location, c.user_agent, c.matched_rule
+		 FROM clicks c JOIN short_urls u ON u.id = c.shortcode
+		 WHERE u.expires_at < ? AND u.fallback_url = '' ORDER BY c.id`),
+		cutoff.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var shortcode string
+		var click models.Click
+		var matchedRule sql.NullInt64
+		if err := rows.Scan(&shortcode, &click.Timestamp, &click.Referrer, &click.Location, &click.UserAgent, &matchedRule); err != nil {
+			return nil, err
+		}
+		click.MatchedRule = optionalInt(matchedRule)
+		if i, ok := index[shortcode]; ok {
+			expired[i].ClickData = append(expired[i].ClickData, click)
+		}
+	}
+	return expired, rows.Err()
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanShortURL reads a short URL selected with shortURLColumns
+func scanShortURL(row rowScanner) (models.ShortURL, error) {
+	var shortURL models.ShortURL
+	var activatesAt sql.NullTime
+	var rules string
+	err := row.Scan(&shortURL.ID, &shortURL.OriginalURL, &shortURL.CreatedAt, &shortURL.ExpiresAt, &shortURL.Clicks, &shortURL.Owner,
+		&shortURL.Preview, &shortURL.RedirectType, &shortURL.PasswordHash, &shortURL.MaxClicks, &activatesAt, &shortURL.FallbackURL, &rules, &shortURL.Deleted)
+	if err != nil {
+		return shortURL, err
+	}
+	if activatesAt.Valid {
+		shortURL.ActivatesAt = activatesAt.Time
+	}
+	if rules != "" {
+		if err := json.Unmarshal([]byte(rules), &shortURL.RedirectRules); err != nil {
+			return shortURL, fmt.Errorf("decode redirect rules of %s: %w", shortURL.ID, err)
+		}
+	}
+	return shortURL, nil
+}
+
+// encodeRules stores redirect rules as JSON, and no rules as an empty
+// string
+func encodeRules(rules []models.RedirectRule) (string, error) {
+	if len(rules) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return "", fmt.Errorf("encode redirect rules: %w", err)
+	}
+	return string(data), nil
+}
+
+// nullTime stores the zero time as NULL
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// nullInt stores a nil int as NULL
+func nullInt(n *int) sql.NullInt64 {
+	if n == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*n), Valid: true}
+}
+
+// optionalInt reads a nullable integer column
+func optionalInt(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	i := int(n.Int64)
+	return &i
+}
+
+// requireAffected maps an UPDATE or DELETE that touched no rows to
+// ErrShortcodeNotFound
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrShortcodeNotFound
+	}
+	return nil
+}
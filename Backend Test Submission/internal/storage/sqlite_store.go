@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	// Register the pure-Go SQLite driver
+	_ "modernc.org/sqlite"
+)
+
+// sqliteDialect describes the SQLite schema and query syntax
+var sqliteDialect = sqlDialect{
+	migrations: []string{
+		`CREATE TABLE short_urls (
+			id           TEXT PRIMARY KEY,
+			original_url TEXT NOT NULL,
+			created_at   TIMESTAMP NOT NULL,
+			expires_at   TIMESTAMP NOT NULL,
+			clicks       INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE TABLE clicks (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			shortcode  TEXT NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE,
+			timestamp  TIMESTAMP NOT NULL,
+			referrer   TEXT NOT NULL DEFAULT '',
+			location   TEXT NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX idx_clicks_shortcode ON clicks(shortcode);`,
+		`ALTER TABLE short_urls ADD COLUMN owner TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE short_urls ADD COLUMN preview BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE short_urls ADD COLUMN redirect_type INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE short_urls ADD COLUMN password_hash TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE short_urls ADD COLUMN max_clicks INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE short_urls ADD COLUMN activates_at TIMESTAMP`,
+		`ALTER TABLE short_urls ADD COLUMN fallback_url TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE short_urls ADD COLUMN redirect_rules TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE clicks ADD COLUMN matched_rule INTEGER`,
+		`ALTER TABLE short_urls ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT FALSE`,
+	},
+}
+
+// SQLiteURLStore implements URLStore on top of a SQLite database file
+type SQLiteURLStore struct {
+	*sqlURLStore
+}
+
+// NewSQLiteURLStore opens (or creates) the SQLite database at path and
+// applies any pending schema migrations
+func NewSQLiteURLStore(path string) (*SQLiteURLStore, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite database: %w", err)
+	}
+
+	// SQLite allows a single writer; serializing access through one
+	// connection avoids SQLITE_BUSY errors and keeps :memory: databases intact
+	db.SetMaxOpenConns(1)
+
+	store, err := newSQLURLStore(db, sqliteDialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteURLStore{store}, nil
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"12217467/backend_test_submission/internal/models"
+)
+
+func TestSQLiteURLStore(t *testing.T) {
+	store, err := NewSQLiteURLStore(filepath.Join(t.TempDir(), "shortener.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	testURLStore(t, store, "")
+}
+
+func TestSQLiteURLStoreReopen(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "shortener.db")
+	store, err := NewSQLiteURLStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	now := time.Now()
+	store.Create(ctx, models.ShortURL{
+		ID:          "persisted",
+		OriginalURL: "https://example.com",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(30 * time.Minute),
+	})
+	store.RecordClick(ctx, "persisted", models.Click{Timestamp: now})
+	store.Close()
+
+	// Reopening re-runs migrations, which must be a no-op
+	store, err = NewSQLiteURLStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	got, err := store.Get(ctx, "persisted")
+	if err != nil {
+		t.Fatalf("Failed to get short URL after reopen: %v", err)
+	}
+	if clicks, _ := store.ListClicks(ctx, "persisted"); got.Clicks != 1 || len(clicks) != 1 {
+		t.Errorf("Expected 1 click after reopen, got %d", got.Clicks)
+	}
+}
+
+func TestSQLiteURLStorePurgeExpired(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	store, err := NewSQLiteURLStore(filepath.Join(t.TempDir(), "shortener.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now()
+	store.Create(ctx, models.ShortURL{ID: "active", OriginalURL: "https://example.com", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	store.Create(ctx, models.ShortURL{ID: "expired", OriginalURL: "https://example.com", CreatedAt: now, ExpiresAt: now.Add(time.Minute)})
+	store.RecordClick(ctx, "expired", models.Click{Timestamp: now})
+	store.Create(ctx, models.ShortURL{ID: "fallback", OriginalURL: "https://example.com", CreatedAt: now, ExpiresAt: now.Add(time.Minute), FallbackURL: "https://example.com/expired"})
+
+	var archived []models.ShortURL
+	purged, err := store.PurgeExpired(ctx, now.Add(2*time.Minute), func(urls []models.ShortURL) error {
+		archived = urls
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to purge: %v", err)
+	}
+
+	if purged != 1 || store.ShortcodeExists(ctx, "expired") || !store.ShortcodeExists(ctx, "active") {
+		t.Errorf("Expected only the expired entry to be purged, purged %d", purged)
+	}
+	if !store.ShortcodeExists(ctx, "fallback") {
+		t.Error("Expected the expired entry with a fallback to be kept")
+	}
+	if len(archived) != 1 || len(archived[0].ClickData) != 1 {
+		t.Errorf("Expected the expired entry and its click to be archived, got %+v", archived)
+	}
+}
@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"12217467/backend_test_submission/internal/models"
+)
+
+// testURLStore exercises the behaviour every URLStore implementation must
+// share. Shortcodes are prefixed so runs against a shared database do not
+// collide.
+func testURLStore(t *testing.T, store URLStore, prefix string) {
+	ctx := context.Background()
+	now := time.Now()
+	bot := false
+	shortURL := models.ShortURL{
+		ID:           prefix + "code",
+		OriginalURL:  "https://example.com",
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(30 * time.Minute),
+		ClickData:    []models.Click{},
+		Owner:        "owner",
+		Preview:      true,
+		RedirectType: 301,
+		PasswordHash: "hash",
+		FallbackURL:  "https://example.com/fallback",
+		RedirectRules: []models.RedirectRule{
+			{OS: "ios", URL: "https://apps.example.com/ios"},
+			{Device: "mobile", Bot: &bot, URL: "https://m.example.com"},
+		},
+	}
+
+	// Test case: Create and get
+	t.Run("Create and get", func(t *testing.T) {
+		if err := store.Create(ctx, shortURL); err != nil {
+			t.Fatalf("Failed to create short URL: %v", err)
+		}
+
+		got, err := store.Get(ctx, shortURL.ID)
+		if err != nil {
+			t.Fatalf("Failed to get short URL: %v", err)
+		}
+		if got.OriginalURL != shortURL.OriginalURL {
+			t.Errorf("Expected originalUrl %s, got %s", shortURL.OriginalURL, got.OriginalURL)
+		}
+		if got.ExpiresAt.Sub(shortURL.ExpiresAt).Abs() > time.Millisecond {
+			t.Errorf("Expected expiresAt %v, got %v", shortURL.ExpiresAt, got.ExpiresAt)
+		}
+		if got.Owner != shortURL.Owner {
+			t.Errorf("Expected owner %s, got %s", shortURL.Owner, got.Owner)
+		}
+		if got.Preview != shortURL.Preview {
+			t.Errorf("Expected preview %v, got %v", shortURL.Preview, got.Preview)
+		}
+		if got.RedirectType != shortURL.RedirectType {
+			t.Errorf("Expected redirectType %d, got %d", shortURL.RedirectType, got.RedirectType)
+		}
+		if got.PasswordHash != shortURL.PasswordHash {
+			t.Errorf("Expected passwordHash %s, got %s", shortURL.PasswordHash, got.PasswordHash)
+		}
+		if got.FallbackURL != shortURL.FallbackURL {
+			t.Errorf("Expected fallbackUrl %s, got %s", shortURL.FallbackURL, got.FallbackURL)
+		}
+		if !reflect.DeepEqual(got.RedirectRules, shortURL.RedirectRules) {
+			t.Errorf("Expected redirectRules %+v, got %+v", shortURL.RedirectRules, got.RedirectRules)
+		}
+	})
+
+	// Test case: Duplicate shortcode
+	t.Run("Duplicate shortcode", func(t *testing.T) {
+		if err := store.Create(ctx, shortURL); err != ErrShortcodeExists {
+			t.Errorf("Expected %v, got %v", ErrShortcodeExists, err)
+		}
+	})
+
+	// Test case: Record click
+	t.Run("Record click", func(t *testing.T) {
+		rule := 1
+		click := models.Click{Timestamp: time.Now(), Referrer: "https://referrer.com", UserAgent: "test", MatchedRule: &rule}
+		if err := store.RecordClick(ctx, shortURL.ID, click); err != nil {
+			t.Fatalf("Failed to record click: %v", err)
+		}
+
+		got, _ := store.Get(ctx, shortURL.ID)
+		if got.Clicks != 1 {
+			t.Fatalf("Expected 1 click, got %d", got.Clicks)
+		}
+		if len(got.ClickData) != 0 {
+			t.Errorf("Expected Get to leave out click data, got %d click records", len(got.ClickData))
+		}
+
+		clicks, err := store.ListClicks(ctx, shortURL.ID)
+		if err != nil {
+			t.Fatalf("Failed to list clicks: %v", err)
+		}
+		if len(clicks) != 1 {
+			t.Fatalf("Expected 1 click record, got %d", len(clicks))
+		}
+		if clicks[0].Referrer != click.Referrer {
+			t.Errorf("Expected referrer %s, got %s", click.Referrer, clicks[0].Referrer)
+		}
+		if matched := clicks[0].MatchedRule; matched == nil || *matched != rule {
+			t.Errorf("Expected matched rule %d, got %v", rule, matched)
+		}
+
+		clicks, err = store.ListClicks(ctx, prefix+"missing")
+		if err != nil || len(clicks) != 0 {
+			t.Errorf("Expected no clicks for unknown shortcode, got %d (%v)", len(clicks), err)
+		}
+	})
+
+	// Test case: Update keeps click statistics
+	t.Run("Update", func(t *testing.T) {
+		updated := shortURL
+		updated.OriginalURL = "https://example.org"
+		updated.ExpiresAt = now.Add(time.Hour)
+		updated.Preview = false
+		updated.RedirectType = 307
+		updated.PasswordHash = ""
+		if err := store.Update(ctx, updated); err != nil {
+			t.Fatalf("Failed to update short URL: %v", err)
+		}
+
+		got, err := store.Get(ctx, shortURL.ID)
+		if err != nil {
+			t.Fatalf("Failed to get short URL: %v", err)
+		}
+		if got.OriginalURL != updated.OriginalURL {
+			t.Errorf("Expected originalUrl %s, got %s", updated.OriginalURL, got.OriginalURL)
+		}
+		if got.ExpiresAt.Sub(updated.ExpiresAt).Abs() > time.Millisecond {
+			t.Errorf("Expected expiresAt %v, got %v", updated.ExpiresAt, got.ExpiresAt)
+		}
+		if got.Preview {
+			t.Error("Expected preview to be turned off")
+		}
+		if got.RedirectType != updated.RedirectType {
+			t.Errorf("Expected redirectType %d, got %d", updated.RedirectType, got.RedirectType)
+		}
+		if got.PasswordHash != "" {
+			t.Error("Expected password to be removed")
+		}
+		clicks, _ := store.ListClicks(ctx, shortURL.ID)
+		if got.Clicks != 1 || len(clicks) != 1 {
+			t.Errorf("Expected click statistics to be kept, got %d (%d click records)", got.Clicks, len(clicks))
+		}
+
+		missing := shortURL
+		missing.ID = prefix + "missing"
+		if err := store.Update(ctx, missing); err != ErrShortcodeNotFound {
+			t.Errorf("Expected %v, got %v", ErrShortcodeNotFound, err)
+		}
+	})
+
+	// Test case: Click limit
+	t.Run("Click limit", func(t *testing.T) {
+		limited := shortURL
+		limited.ID = prefix + "limited"
+		limited.MaxClicks = 3
+		if err := store.Create(ctx, limited); err != nil {
+			t.Fatalf("Failed to create short URL: %v", err)
+		}
+		defer store.Delete(ctx, limited.ID)
+
+		got, _ := store.Get(ctx, limited.ID)
+		if got.MaxClicks != limited.MaxClicks {
+			t.Errorf("Expected maxClicks %d, got %d", limited.MaxClicks, got.MaxClicks)
+		}
+
+		// Concurrent clicks must not overshoot the limit
+		var wg sync.WaitGroup
+		var mutex sync.Mutex
+		recorded, refused := 0, 0
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := store.RecordClick(ctx, limited.ID, models.Click{Timestamp: time.Now()})
+				mutex.Lock()
+				defer mutex.Unlock()
+				switch err {
+				case nil:
+					recorded++
+				case ErrClickLimitReached:
+					refused++
+				default:
+					t.Errorf("Unexpected error: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if recorded != limited.MaxClicks || refused != 10-limited.MaxClicks {
+			t.Errorf("Expected %d clicks recorded and %d refused, got %d and %d", limited.MaxClicks, 10-limited.MaxClicks, recorded, refused)
+		}
+		got, _ = store.Get(ctx, limited.ID)
+		if got.Clicks != limited.MaxClicks {
+			t.Errorf("Expected %d clicks, got %d", limited.MaxClicks, got.Clicks)
+		}
+	})
+
+	// Test case: Links that never expire
+	t.Run("Never expires", func(t *testing.T) {
+		forever := shortURL
+		forever.ID = prefix + "forever"
+		forever.ExpiresAt = models.NeverExpires
+		if err := store.Create(ctx, forever); err != nil {
+			t.Fatalf("Failed to create short URL: %v", err)
+		}
+		defer store.Delete(ctx, forever.ID)
+
+		got, err := store.Get(ctx, forever.ID)
+		if err != nil {
+			t.Fatalf("Failed to get short URL: %v", err)
+		}
+		if !got.ExpiresAt.Equal(models.NeverExpires) {
+			t.Errorf("Expected expiresAt %v, got %v", models.NeverExpires, got.ExpiresAt)
+		}
+		if err := store.RecordClick(ctx, forever.ID, models.Click{Timestamp: time.Now()}); err != nil {
+			t.Errorf("Failed to record click: %v", err)
+		}
+	})
+
+	// Test case: Scheduled activation
+	t.Run("Not active yet", func(t *testing.T) {
+		scheduled := shortURL
+		scheduled.ID = prefix + "scheduled"
+		scheduled.ActivatesAt = now.Add(time.Hour)
+		scheduled.ExpiresAt = now.Add(2 * time.Hour)
+		store.Create(ctx, scheduled)
+		defer store.Delete(ctx, scheduled.ID)
+
+		got, err := store.Get(ctx, scheduled.ID)
+		if err != ErrShortcodeNotActive {
+			t.Errorf("Expected %v, got %v", ErrShortcodeNotActive, err)
+		}
+		if got.ID != scheduled.ID || got.ActivatesAt.Sub(scheduled.ActivatesAt).Abs() > time.Millisecond {
+			t.Errorf("Expected the scheduled record, got %+v", got)
+		}
+		if err := store.RecordClick(ctx, scheduled.ID, models.Click{}); err != ErrShortcodeNotActive {
+			t.Errorf("Expected %v, got %v", ErrShortcodeNotActive, err)
+		}
+
+		// Activating the link makes it resolve
+		got.ActivatesAt = now.Add(-time.Minute)
+		if err := store.Update(ctx, got); err != nil {
+			t.Fatalf("Failed to update short URL: %v", err)
+		}
+		if _, err := store.Get(ctx, scheduled.ID); err != nil {
+			t.Errorf("Expected active short URL, got %v", err)
+		}
+	})
+
+	// Test case: Expired shortcode
+	t.Run("Expired shortcode", func(t *testing.T) {
+		expired := shortURL
+		expired.ID = prefix + "expired"
+		expired.ExpiresAt = now.Add(-time.Minute)
+		store.Create(ctx, expired)
+		defer store.Delete(ctx, expired.ID)
+
+		got, err := store.Get(ctx, expired.ID)
+		if err != ErrShortcodeExpired {
+			t.Errorf("Expected %v, got %v", ErrShortcodeExpired, err)
+		}
+		if got.FallbackURL != expired.FallbackURL {
+			t.Errorf("Expected the expired record with fallbackUrl %s, got %q", expired.FallbackURL, got.FallbackURL)
+		}
+		if err := store.RecordClick(ctx, expired.ID, models.Click{}); err != ErrShortcodeExpired {
+			t.Errorf("Expected %v, got %v", ErrShortcodeExpired, err)
+		}
+	})
+
+	// Test case: Delete
+	t.Run("Delete", func(t *testing.T) {
+		if err := store.Delete(ctx, shortURL.ID); err != nil {
+			t.Fatalf("Failed to delete short URL: %v", err)
+		}
+		got, err := store.Get(ctx, shortURL.ID)
+		if err != ErrShortcodeDeleted {
+			t.Errorf("Expected %v, got %v", ErrShortcodeDeleted, err)
+		}
+		if got.OriginalURL != "" || got.PasswordHash != "" {
+			t.Errorf("Expected the tombstone to drop the link's data, got %+v", got)
+		}
+		if clicks, _ := store.ListClicks(ctx, shortURL.ID); len(clicks) != 0 {
+			t.Errorf("Expected click history to be removed, got %d click records", len(clicks))
+		}
+		if err := store.RecordClick(ctx, shortURL.ID, models.Click{Timestamp: time.Now()}); err != ErrShortcodeDeleted {
+			t.Errorf("Expected %v for click, got %v", ErrShortcodeDeleted, err)
+		}
+
+		// The shortcode stays taken
+		if !store.ShortcodeExists(ctx, shortURL.ID) {
+			t.Error("Expected shortcode to stay taken")
+		}
+		if err := store.Create(ctx, shortURL); err != ErrShortcodeExists {
+			t.Errorf("Expected %v on re-create, got %v", ErrShortcodeExists, err)
+		}
+		if err := store.Update(ctx, shortURL); err != ErrShortcodeNotFound {
+			t.Errorf("Expected %v on update, got %v", ErrShortcodeNotFound, err)
+		}
+		if err := store.Delete(ctx, shortURL.ID); err != ErrShortcodeNotFound {
+			t.Errorf("Expected %v, got %v", ErrShortcodeNotFound, err)
+		}
+	})
+}
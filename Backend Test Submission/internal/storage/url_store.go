@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
@@ -17,33 +18,99 @@ var (
 
 	// ErrShortcodeExpired is returned when a shortcode has expired
 	ErrShortcodeExpired = errors.New("shortcode has expired")
+
+	// ErrShortcodeNotActive is returned for a shortcode whose ActivatesAt
+	// lies in the future
+	ErrShortcodeNotActive = errors.New("shortcode is not active yet")
+
+	// ErrClickLimitReached is returned by RecordClick once a short URL has
+	// been clicked MaxClicks times
+	ErrClickLimitReached = errors.New("click limit reached")
+
+	// ErrShortcodeDeleted is returned for a shortcode whose short URL has
+	// been deleted
+	ErrShortcodeDeleted = errors.New("shortcode has been deleted")
 )
 
-// URLStore defines the interface for URL storage operations
+// URLStore defines the interface for URL storage operations. Every method
+// takes a context so slow backends can give up when the caller goes away.
 type URLStore interface {
-	// Create stores a new short URL
-	Create(shortURL models.ShortURL) error
-
-	// Get retrieves a short URL by its shortcode
-	Get(shortcode string) (models.ShortURL, error)
+	// Create atomically stores a new short URL, returning
+	// ErrShortcodeExists if its shortcode is already taken. It is the only
+	// safe way to reserve a shortcode; ShortcodeExists is advisory.
+	Create(ctx context.Context, shortURL models.ShortURL) error
+
+	// Get retrieves a short URL by its shortcode, with its click count but
+	// without ClickData, so that redirects do not pay for the link's click
+	// history. For short URLs that are not active yet it returns the record
+	// together with ErrShortcodeNotActive, so that they can still be
+	// managed. Expired short URLs are returned together with
+	// ErrShortcodeExpired, so that their fallback can be served.
+	Get(ctx context.Context, shortcode string) (models.ShortURL, error)
+
+	// ListClicks returns the click events of a short URL, oldest first.
+	// Unknown shortcodes have no clicks.
+	ListClicks(ctx context.Context, shortcode string) ([]models.Click, error)
 
 	// Update updates an existing short URL
-	Update(shortURL models.ShortURL) error
+	Update(ctx context.Context, shortURL models.ShortURL) error
+
+	// Delete replaces a short URL with a tombstone and removes its click
+	// history. The tombstone keeps the shortcode taken until the link would
+	// have expired, so that it cannot be claimed by someone else: Get and
+	// RecordClick report ErrShortcodeDeleted for it, and Create
+	// ErrShortcodeExists.
+	Delete(ctx context.Context, shortcode string) error
+
+	// RecordClick records a click event for a shortcode. It returns
+	// ErrClickLimitReached, atomically with the count, once MaxClicks
+	// clicks have been recorded.
+	RecordClick(ctx context.Context, shortcode string, click models.Click) error
+
+	// ShortcodeExists checks if a shortcode already exists. The answer may be
+	// stale by the time it is used, so callers must not rely on it to
+	// reserve a shortcode.
+	ShortcodeExists(ctx context.Context, shortcode string) bool
+}
 
-	// Delete removes a short URL
-	Delete(shortcode string) error
+// activationError returns ErrShortcodeNotActive if shortURL is scheduled to
+// become active later
+func activationError(shortURL models.ShortURL) error {
+	if time.Now().Before(shortURL.ActivatesAt) {
+		return ErrShortcodeNotActive
+	}
+	return nil
+}
 
-	// RecordClick records a click event for a shortcode
-	RecordClick(shortcode string, click models.Click) error
+// tombstone returns the record left behind when shortURL is deleted
+func tombstone(shortURL models.ShortURL) models.ShortURL {
+	return models.ShortURL{
+		ID:        shortURL.ID,
+		CreatedAt: shortURL.CreatedAt,
+		ExpiresAt: shortURL.ExpiresAt,
+		Owner:     shortURL.Owner,
+		Deleted:   true,
+	}
+}
 
-	// ShortcodeExists checks if a shortcode already exists
-	ShortcodeExists(shortcode string) bool
+// ExpiredPurger is implemented by stores that can remove expired short URLs
+// in bulk. Stores whose backend expires records on its own do not need it.
+type ExpiredPurger interface {
+	// PurgeExpired removes every short URL that expired before cutoff and
+	// returns how many were removed. Short URLs with a FallbackURL are kept
+	// until they are deleted, since their fallback is served after expiry.
+	// If archive is non-nil it receives the records first, and nothing is
+	// removed when it returns an error.
+	PurgeExpired(ctx context.Context, cutoff time.Time, archive func([]models.ShortURL) error) (int, error)
 }
 
 // InMemoryURLStore implements URLStore with in-memory storage
 type InMemoryURLStore struct {
 	urls  map[string]models.ShortURL
 	mutex sync.RWMutex
+
+	// wal is nil unless the store was opened with persistence
+	wal *writeAheadLog
 }
 
 // NewURLStore creates a new InMemoryURLStore
@@ -53,8 +120,72 @@ func NewURLStore() *InMemoryURLStore {
 	}
 }
 
+// NewPersistentURLStore creates an InMemoryURLStore that records every
+// mutation in a write-ahead log under config.Dir. Existing state is
+// restored by replaying the latest snapshot and the log on top of it.
+func NewPersistentURLStore(config PersistenceConfig) (*InMemoryURLStore, error) {
+	wal, urls, err := openWriteAheadLog(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InMemoryURLStore{
+		urls: urls,
+		wal:  wal,
+	}, nil
+}
+
+// persist appends entry to the write-ahead log, if any. Callers must hold
+// the write lock and apply the mutation only when persist succeeds.
+func (s *InMemoryURLStore) persist(entry walEntry) error {
+	if s.wal == nil {
+		return nil
+	}
+	return s.wal.append(entry)
+}
+
+// maybeCompact folds the log into a snapshot once it has grown enough.
+// Failures are not fatal: the log stays authoritative and compaction is
+// retried after the next write. Callers must hold the write lock.
+func (s *InMemoryURLStore) maybeCompact() {
+	if s.wal != nil && s.wal.shouldCompact() {
+		s.wal.compact(s.urls)
+	}
+}
+
+// Compact writes a snapshot of the current state and empties the
+// write-ahead log. It is a no-op for stores without persistence.
+func (s *InMemoryURLStore) Compact() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.wal == nil {
+		return nil
+	}
+	return s.wal.compact(s.urls)
+}
+
+// Close compacts and closes the write-ahead log of a persistent store
+func (s *InMemoryURLStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.wal == nil {
+		return nil
+	}
+	if err := s.wal.compact(s.urls); err != nil {
+		s.wal.close()
+		return err
+	}
+	return s.wal.close()
+}
+
 // Create stores a new short URL
-func (s *InMemoryURLStore) Create(shortURL models.ShortURL) error {
+func (s *InMemoryURLStore) Create(ctx context.Context, shortURL models.ShortURL) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -62,12 +193,21 @@ func (s *InMemoryURLStore) Create(shortURL models.ShortURL) error {
 		return ErrShortcodeExists
 	}
 
+	if err := s.persist(walEntry{Op: walOpCreate, ShortURL: &shortURL}); err != nil {
+		return err
+	}
+
 	s.urls[shortURL.ID] = shortURL
+	s.maybeCompact()
 	return nil
 }
 
 // Get retrieves a short URL by its shortcode
-func (s *InMemoryURLStore) Get(shortcode string) (models.ShortURL, error) {
+func (s *InMemoryURLStore) Get(ctx context.Context, shortcode string) (models.ShortURL, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ShortURL{}, err
+	}
+
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
@@ -76,42 +216,87 @@ func (s *InMemoryURLStore) Get(shortcode string) (models.ShortURL, error) {
 		return models.ShortURL{}, ErrShortcodeNotFound
 	}
 
+	shortURL.ClickData = nil
+	if shortURL.Deleted {
+		return shortURL, ErrShortcodeDeleted
+	}
+
 	// Check if the URL has expired
 	if time.Now().After(shortURL.ExpiresAt) {
-		return models.ShortURL{}, ErrShortcodeExpired
+		return shortURL, ErrShortcodeExpired
 	}
 
-	return shortURL, nil
+	return shortURL, activationError(shortURL)
 }
 
-// Update updates an existing short URL
-func (s *InMemoryURLStore) Update(shortURL models.ShortURL) error {
+// ListClicks returns the click events of a short URL
+func (s *InMemoryURLStore) ListClicks(ctx context.Context, shortcode string) ([]models.Click, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return append([]models.Click{}, s.urls[shortcode].ClickData...), nil
+}
+
+// Update updates an existing short URL. Click counters are owned by
+// RecordClick and are left untouched.
+func (s *InMemoryURLStore) Update(ctx context.Context, shortURL models.ShortURL) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if _, exists := s.urls[shortURL.ID]; !exists {
+	existing, exists := s.urls[shortURL.ID]
+	if !exists || existing.Deleted {
 		return ErrShortcodeNotFound
 	}
+	shortURL.Clicks = existing.Clicks
+	shortURL.ClickData = existing.ClickData
+
+	if err := s.persist(walEntry{Op: walOpUpdate, ShortURL: &shortURL}); err != nil {
+		return err
+	}
 
 	s.urls[shortURL.ID] = shortURL
+	s.maybeCompact()
 	return nil
 }
 
-// Delete removes a short URL
-func (s *InMemoryURLStore) Delete(shortcode string) error {
+// Delete replaces a short URL with a tombstone
+func (s *InMemoryURLStore) Delete(ctx context.Context, shortcode string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if _, exists := s.urls[shortcode]; !exists {
+	shortURL, exists := s.urls[shortcode]
+	if !exists || shortURL.Deleted {
 		return ErrShortcodeNotFound
 	}
 
-	delete(s.urls, shortcode)
+	deleted := tombstone(shortURL)
+	if err := s.persist(walEntry{Op: walOpUpdate, ShortURL: &deleted}); err != nil {
+		return err
+	}
+
+	s.urls[shortcode] = deleted
+	s.maybeCompact()
 	return nil
 }
 
 // RecordClick records a click event for a shortcode
-func (s *InMemoryURLStore) RecordClick(shortcode string, click models.Click) error {
+func (s *InMemoryURLStore) RecordClick(ctx context.Context, shortcode string, click models.Click) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -119,11 +304,24 @@ func (s *InMemoryURLStore) RecordClick(shortcode string, click models.Click) err
 	if !exists {
 		return ErrShortcodeNotFound
 	}
+	if shortURL.Deleted {
+		return ErrShortcodeDeleted
+	}
 
 	// Check if the URL has expired
 	if time.Now().After(shortURL.ExpiresAt) {
 		return ErrShortcodeExpired
 	}
+	if err := activationError(shortURL); err != nil {
+		return err
+	}
+	if shortURL.MaxClicks > 0 && shortURL.Clicks >= shortURL.MaxClicks {
+		return ErrClickLimitReached
+	}
+
+	if err := s.persist(walEntry{Op: walOpRecordClick, Shortcode: shortcode, Click: &click}); err != nil {
+		return err
+	}
 
 	// Update click count and add click data
 	shortURL.Clicks++
@@ -131,14 +329,58 @@ func (s *InMemoryURLStore) RecordClick(shortcode string, click models.Click) err
 
 	// Update the URL in the store
 	s.urls[shortcode] = shortURL
+	s.maybeCompact()
 	return nil
 }
 
 // ShortcodeExists checks if a shortcode already exists
-func (s *InMemoryURLStore) ShortcodeExists(shortcode string) bool {
+func (s *InMemoryURLStore) ShortcodeExists(ctx context.Context, shortcode string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
 	_, exists := s.urls[shortcode]
 	return exists
 }
+
+// PurgeExpired removes every short URL without a fallback that expired
+// before cutoff
+func (s *InMemoryURLStore) PurgeExpired(ctx context.Context, cutoff time.Time, archive func([]models.ShortURL) error) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var expired []models.ShortURL
+	for _, shortURL := range s.urls {
+		if shortURL.ExpiresAt.Before(cutoff) && shortURL.FallbackURL == "" {
+			expired = append(expired, shortURL)
+		}
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	if archive != nil {
+		if err := archive(expired); err != nil {
+			return 0, err
+		}
+	}
+
+	purged := 0
+	for _, shortURL := range expired {
+		if err := s.persist(walEntry{Op: walOpDelete, Shortcode: shortURL.ID}); err != nil {
+			return purged, err
+		}
+		delete(s.urls, shortURL.ID)
+		purged++
+	}
+
+	s.maybeCompact()
+	return purged, nil
+}
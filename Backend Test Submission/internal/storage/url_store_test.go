@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"12217467/backend_test_submission/internal/models"
+)
+
+func TestInMemoryURLStore(t *testing.T) {
+	testURLStore(t, NewURLStore(), "")
+}
+
+func TestInMemoryURLStoreCancellation(t *testing.T) {
+	// Setup
+	store := NewURLStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	now := time.Now()
+	shortURL := models.ShortURL{ID: "cancelled", OriginalURL: "https://example.com", CreatedAt: now, ExpiresAt: now.Add(time.Minute)}
+
+	// Test case: Cancelled calls fail without touching the store
+	if err := store.Create(ctx, shortURL); err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := store.Get(ctx, shortURL.ID); err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if store.ShortcodeExists(context.Background(), shortURL.ID) {
+		t.Error("Expected cancelled create to leave the store untouched")
+	}
+}
@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"12217467/backend_test_submission/internal/models"
+)
+
+const (
+	// DefaultCompactEvery is the number of log entries after which the
+	// write-ahead log is folded into a new snapshot
+	DefaultCompactEvery = 1000
+
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.json"
+)
+
+// Write-ahead log operations
+const (
+	walOpCreate      = "create"
+	walOpUpdate      = "update"
+	walOpDelete      = "delete"
+	walOpRecordClick = "click"
+)
+
+// PersistenceConfig configures the optional on-disk persistence of an
+// InMemoryURLStore
+type PersistenceConfig struct {
+	// Dir holds the snapshot and write-ahead log files
+	Dir string
+
+	// CompactEvery folds the log into a snapshot after this many entries
+	// (defaults to DefaultCompactEvery)
+	CompactEvery int
+
+	// SyncWrites fsyncs the log after every entry. Without it a crash of the
+	// machine (not just the process) can lose the most recent writes.
+	SyncWrites bool
+}
+
+// walEntry is a single line of the write-ahead log
+type walEntry struct {
+	Seq       uint64           `json:"seq"`
+	Op        string           `json:"op"`
+	ShortURL  *models.ShortURL `json:"shortUrl,omitempty"`
+	Shortcode string           `json:"shortcode,omitempty"`
+	Click     *models.Click    `json:"click,omitempty"`
+}
+
+// walSnapshot is the compacted state written to snapshot.json
+type walSnapshot struct {
+	// LastSeq is the sequence number of the last entry folded into URLs;
+	// replay skips entries at or below it
+	LastSeq uint64                     `json:"lastSeq"`
+	URLs    map[string]models.ShortURL `json:"urls"`
+}
+
+// writeAheadLog appends store mutations to a file and periodically
+// compacts them into a snapshot. It is not safe for concurrent use; the
+// owning store serializes access with its mutex.
+type writeAheadLog struct {
+	config  PersistenceConfig
+	file    *os.File
+	seq     uint64 // sequence number of the last entry written
+	pending int    // entries written since the last snapshot
+}
+
+// openWriteAheadLog loads the snapshot, replays the log on top of it and
+// returns the log ready for appending together with the recovered state
+func openWriteAheadLog(config PersistenceConfig) (*writeAheadLog, map[string]models.ShortURL, error) {
+	if config.CompactEvery <= 0 {
+		config.CompactEvery = DefaultCompactEvery
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, nil, fmt.Errorf("create persistence directory: %w", err)
+	}
+
+	snapshot, err := readSnapshot(filepath.Join(config.Dir, snapshotFileName))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(config.Dir, walFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open write-ahead log: %w", err)
+	}
+
+	wal := &writeAheadLog{config: config, file: file, seq: snapshot.LastSeq}
+	if err := wal.replay(snapshot); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return wal, snapshot.URLs, nil
+}
+
+// readSnapshot loads the snapshot at path, returning an empty one if it
+// does not exist yet
+func readSnapshot(path string) (walSnapshot, error) {
+	snapshot := walSnapshot{URLs: make(map[string]models.ShortURL)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshot, nil
+	}
+	if err != nil {
+		return snapshot, fmt.Errorf("read snapshot: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("decode snapshot: %w", err)
+	}
+	if snapshot.URLs == nil {
+		snapshot.URLs = make(map[string]models.ShortURL)
+	}
+	return snapshot, nil
+}
+
+// replay applies every log entry newer than the snapshot. A torn final
+// line left by a crash mid-write is truncated away; corruption anywhere
+// else is reported as an error.
+func (w *writeAheadLog) replay(snapshot walSnapshot) error {
+	reader := bufio.NewReader(w.file)
+	var offset int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				// Incomplete last entry; drop it
+				if err := w.file.Truncate(offset); err != nil {
+					return fmt.Errorf("truncate torn write-ahead log entry: %w", err)
+				}
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read write-ahead log: %w", err)
+		}
+
+		var entry walEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("decode write-ahead log entry at offset %d: %w", offset, err)
+		}
+		offset += int64(len(line))
+
+		if entry.Seq <= snapshot.LastSeq {
+			continue
+		}
+		applyWALEntry(snapshot.URLs, entry)
+		w.seq = entry.Seq
+		w.pending++
+	}
+
+	if _, err := w.file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seek write-ahead log: %w", err)
+	}
+	return nil
+}
+
+// applyWALEntry replays a logged mutation against urls
+func applyWALEntry(urls map[string]models.ShortURL, entry walEntry) {
+	switch entry.Op {
+	case walOpCreate, walOpUpdate:
+		if entry.ShortURL != nil {
+			urls[entry.ShortURL.ID] = *entry.ShortURL
+		}
+	case walOpDelete:
+		delete(urls, entry.Shortcode)
+	case walOpRecordClick:
+		shortURL, exists := urls[entry.Shortcode]
+		if !exists || entry.Click == nil {
+			return
+		}
+		shortURL.Clicks++
+		shortURL.ClickData = append(shortURL.ClickData, *entry.Click)
+		urls[entry.Shortcode] = shortURL
+	}
+}
+
+// append writes entry to the log, assigning it the next sequence number
+func (w *writeAheadLog) append(entry walEntry) error {
+	entry.Seq = w.seq + 1
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := w.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("append to write-ahead log: %w", err)
+	}
+	if w.config.SyncWrites {
+		if err := w.file.Sync(); err != nil {
+			return fmt.Errorf("sync write-ahead log: %w", err)
+		}
+	}
+
+	w.seq = entry.Seq
+	w.pending++
+	return nil
+}
+
+// shouldCompact reports whether enough entries have accumulated to warrant
+// a new snapshot
+func (w *writeAheadLog) shouldCompact() bool {
+	return w.pending >= w.config.CompactEvery
+}
+
+// compact writes urls as the new snapshot and empties the log. The
+// snapshot is renamed into place atomically, and its LastSeq makes replay
+// idempotent should the process die before the log is truncated.
+func (w *writeAheadLog) compact(urls map[string]models.ShortURL) error {
+	data, err := json.Marshal(walSnapshot{LastSeq: w.seq, URLs: urls})
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(w.config.Dir, snapshotFileName)
+	tmp, err := os.CreateTemp(w.config.Dir, snapshotFileName+".*")
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("install snapshot: %w", err)
+	}
+
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("truncate write-ahead log: %w", err)
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek write-ahead log: %w", err)
+	}
+
+	w.pending = 0
+	return nil
+}
+
+// close closes the log file
+func (w *writeAheadLog) close() error {
+	return w.file.Close()
+}
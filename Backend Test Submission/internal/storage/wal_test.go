@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"12217467/backend_test_submission/internal/models"
+)
+
+func TestPersistentURLStore(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	dir := t.TempDir()
+	config := PersistenceConfig{Dir: dir, CompactEvery: 3}
+	store, err := NewPersistentURLStore(config)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	now := time.Now()
+	for _, id := range []string{"keep", "change", "remove"} {
+		store.Create(ctx, models.ShortURL{
+			ID:          id,
+			OriginalURL: "https://example.com/" + id,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(30 * time.Minute),
+			ClickData:   []models.Click{},
+		})
+	}
+	changed, _ := store.Get(ctx, "change")
+	changed.OriginalURL = "https://example.org"
+	store.Update(ctx, changed)
+	store.Delete(ctx, "remove")
+	store.RecordClick(ctx, "keep", models.Click{Timestamp: now, Referrer: "https://referrer.com"})
+
+	// Test case: State is replayed from snapshot and log after a crash
+	t.Run("Replay after crash", func(t *testing.T) {
+		// Simulate a crash by abandoning the store without closing it
+		recovered, err := NewPersistentURLStore(config)
+		if err != nil {
+			t.Fatalf("Failed to reopen store: %v", err)
+		}
+		defer recovered.wal.close()
+
+		assertRecoveredState(t, recovered)
+	})
+
+	// Test case: Close compacts everything into the snapshot
+	t.Run("Compact on close", func(t *testing.T) {
+		if err := store.Close(); err != nil {
+			t.Fatalf("Failed to close store: %v", err)
+		}
+
+		if info, err := os.Stat(filepath.Join(dir, walFileName)); err != nil || info.Size() != 0 {
+			t.Errorf("Expected empty write-ahead log after close, got %v (%v)", info.Size(), err)
+		}
+
+		reopened, err := NewPersistentURLStore(config)
+		if err != nil {
+			t.Fatalf("Failed to reopen store: %v", err)
+		}
+		defer reopened.Close()
+
+		assertRecoveredState(t, reopened)
+	})
+
+	// Test case: A torn final entry is discarded
+	t.Run("Torn write", func(t *testing.T) {
+		f, _ := os.OpenFile(filepath.Join(dir, walFileName), os.O_APPEND|os.O_WRONLY, 0o644)
+		f.WriteString(`{"seq":99,"op":"delete","short`)
+		f.Close()
+
+		reopened, err := NewPersistentURLStore(config)
+		if err != nil {
+			t.Fatalf("Failed to reopen store: %v", err)
+		}
+		defer reopened.Close()
+
+		assertRecoveredState(t, reopened)
+	})
+}
+
+// assertRecoveredState checks the state produced by TestPersistentURLStore
+func assertRecoveredState(t *testing.T, store *InMemoryURLStore) {
+	ctx := context.Background()
+	t.Helper()
+
+	keep, err := store.Get(ctx, "keep")
+	if err != nil {
+		t.Fatalf("Failed to get recovered short URL: %v", err)
+	}
+	if clicks, _ := store.ListClicks(ctx, "keep"); keep.Clicks != 1 || len(clicks) != 1 {
+		t.Errorf("Expected 1 recovered click, got %d", keep.Clicks)
+	}
+
+	changed, err := store.Get(ctx, "change")
+	if err != nil || changed.OriginalURL != "https://example.org" {
+		t.Errorf("Expected updated URL to be recovered, got %q (%v)", changed.OriginalURL, err)
+	}
+
+	if _, err := store.Get(ctx, "remove"); err != ErrShortcodeDeleted {
+		t.Errorf("Expected deleted shortcode to stay deleted, got %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+package urlpolicy
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultAllowedSchemes are the schemes accepted when none are configured
+var DefaultAllowedSchemes = []string{"http", "https"}
+
+// Violation explains why a destination URL was rejected
+type Violation struct {
+	Reason string
+}
+
+// Error returns the reason for the violation
+func (v *Violation) Error() string {
+	return v.Reason
+}
+
+// violationf creates a Violation with a formatted reason
+func violationf(format string, args ...interface{}) *Violation {
+	return &Violation{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Config configures a Policy
+type Config struct {
+	// AllowedSchemes lists the accepted URL schemes (defaults to
+	// DefaultAllowedSchemes)
+	AllowedSchemes []string
+
+	// SelfHosts lists the hosts the shortener itself is served on, in
+	// addition to the Host of the request. Links to them would loop.
+	SelfHosts []string
+
+	// AllowHosts, if not empty, restricts destinations to these hosts and
+	// their subdomains
+	AllowHosts []string
+
+	// DenyHosts rejects these hosts and their subdomains
+	DenyHosts []string
+}
+
+// Policy decides which destination URLs may be shortened
+type Policy struct {
+	schemes    map[string]bool
+	selfHosts  []string
+	allowHosts []string
+	denyHosts  []string
+}
+
+// New creates a Policy from config
+func New(config Config) *Policy {
+	schemes := config.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = DefaultAllowedSchemes
+	}
+
+	p := &Policy{
+		schemes:    make(map[string]bool, len(schemes)),
+		selfHosts:  normalizeHosts(config.SelfHosts),
+		allowHosts: normalizeHosts(config.AllowHosts),
+		denyHosts:  normalizeHosts(config.DenyHosts),
+	}
+	for _, scheme := range schemes {
+		p.schemes[strings.ToLower(scheme)] = true
+	}
+	return p
+}
+
+// Check returns a *Violation if rawURL may not be shortened. requestHost is
+// the Host the request was made to, which counts as a self-referencing host.
+// Host names are not resolved, so a public name pointing at a private
+// address is not detected.
+func (p *Policy) Check(rawURL, requestHost string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return violationf("URL cannot be parsed: %v", err)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if !p.schemes[scheme] {
+		return violationf("scheme %q is not allowed; use one of: %s", u.Scheme, strings.Join(p.allowedSchemes(), ", "))
+	}
+	if u.User != nil {
+		return violationf("URLs with embedded credentials are not allowed")
+	}
+
+	host := normalizeHost(u.Hostname())
+	if host == "" {
+		return violationf("URL must include a host")
+	}
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return violationf("host %q refers to this machine", host)
+	}
+	if ip := parseIP(host); ip != nil {
+		if reason := blockedAddress(ip); reason != "" {
+			return violationf("address %s is %s", ip, reason)
+		}
+	}
+
+	self := append([]string{normalizeHost(stripPort(requestHost))}, p.selfHosts...)
+	if matchesHost(host, self) {
+		return violationf("links to this shortener are not allowed because they would redirect in a loop")
+	}
+	if matchesHost(host, p.denyHosts) {
+		return violationf("host %q is blocked", host)
+	}
+	if len(p.allowHosts) > 0 && !matchesHost(host, p.allowHosts) {
+		return violationf("host %q is not on the list of allowed hosts", host)
+	}
+	return nil
+}
+
+// allowedSchemes returns the accepted schemes in a stable order for error
+// messages
+func (p *Policy) allowedSchemes() []string {
+	schemes := make([]string, 0, len(p.schemes))
+	for scheme := range p.schemes {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// blockedAddress returns why ip may not be linked to, or "" if it may
+func blockedAddress(ip net.IP) string {
+	switch {
+	case ip.IsLoopback():
+		return "a loopback address"
+	case ip.IsPrivate():
+		return "a private address"
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		return "a link-local address"
+	case ip.IsUnspecified():
+		return "an unspecified address"
+	default:
+		return ""
+	}
+}
+
+// parseIP parses host as an IP address, including the shorthand IPv4 forms
+// browsers accept such as "2130706433" or "0x7f.1"
+func parseIP(host string) net.IP {
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return ip
+	}
+	return parseIPv4Shorthand(host)
+}
+
+// parseIPv4Shorthand implements inet_aton: one to four dot-separated
+// decimal, octal (leading 0) or hexadecimal (leading 0x) parts, the last of
+// which fills the remaining bytes
+func parseIPv4Shorthand(host string) net.IP {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+
+	values := make([]uint64, len(parts))
+	for i, part := range parts {
+		v, err := strconv.ParseUint(part, 0, 32)
+		if err != nil {
+			return nil
+		}
+		values[i] = v
+	}
+
+	var addr uint64
+	for i, v := range values[:len(values)-1] {
+		if v > 0xff {
+			return nil
+		}
+		addr |= v << (24 - 8*uint(i))
+	}
+	last := values[len(values)-1]
+	if last >= 1<<(8*uint(5-len(values))) {
+		return nil
+	}
+	addr |= last
+
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr))
+}
+
+// matchesHost reports whether host equals, or is a subdomain of, one of
+// hosts
+func matchesHost(host string, hosts []string) bool {
+	for _, h := range hosts {
+		if h != "" && (host == h || strings.HasSuffix(host, "."+h)) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeHosts normalizes a configured host list
+func normalizeHosts(hosts []string) []string {
+	normalized := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if host = normalizeHost(stripPort(strings.TrimSpace(host))); host != "" {
+			normalized = append(normalized, host)
+		}
+	}
+	return normalized
+}
+
+// normalizeHost lower-cases host and drops a trailing dot
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// stripPort removes the port from a host:port pair
+func stripPort(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return hostport
+}
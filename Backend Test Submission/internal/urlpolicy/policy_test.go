@@ -0,0 +1,72 @@
+package urlpolicy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	// Setup
+	policy := New(Config{
+		SelfHosts: []string{"sho.rt"},
+		DenyHosts: []string{"evil.example"},
+	})
+
+	tests := []struct {
+		name    string
+		url     string
+		allowed bool
+	}{
+		{"Public HTTPS URL", "https://example.com/path?q=1", true},
+		{"Public IP literal", "http://93.184.216.34/", true},
+		{"JavaScript scheme", "javascript:alert(1)", false},
+		{"FTP scheme", "ftp://example.com/file", false},
+		{"Embedded credentials", "https://example.com@evil.example/", false},
+		{"Localhost", "http://localhost/admin", false},
+		{"Localhost subdomain", "http://app.localhost:8080/", false},
+		{"Loopback IPv4", "http://127.0.0.1:8000/", false},
+		{"Loopback IPv6", "http://[::1]/", false},
+		{"Private IPv4", "http://10.0.0.5/", false},
+		{"Link-local metadata address", "http://169.254.169.254/latest/meta-data/", false},
+		{"Unspecified address", "http://0.0.0.0/", false},
+		{"Decimal loopback shorthand", "http://2130706433/", false},
+		{"Hex loopback shorthand", "http://0x7f.1/", false},
+		{"Request host", "http://shortener.local:8000/abc", false},
+		{"Configured self host", "https://SHO.RT/abc", false},
+		{"Denied host", "https://evil.example/login", false},
+		{"Denied subdomain", "https://login.evil.example/", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.url, "shortener.local:8000")
+			if tt.allowed && err != nil {
+				t.Errorf("Expected %s to be allowed, got %v", tt.url, err)
+			}
+			if !tt.allowed {
+				var violation *Violation
+				if !errors.As(err, &violation) || violation.Reason == "" {
+					t.Errorf("Expected %s to be rejected with a reason, got %v", tt.url, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAllowHosts(t *testing.T) {
+	// Setup
+	policy := New(Config{AllowHosts: []string{"example.com"}, AllowedSchemes: []string{"https"}})
+
+	// Test case: Only listed hosts and their subdomains are accepted
+	if err := policy.Check("https://docs.example.com/", ""); err != nil {
+		t.Errorf("Expected subdomain of allowed host to be accepted, got %v", err)
+	}
+	if err := policy.Check("https://example.org/", ""); err == nil {
+		t.Error("Expected host outside the allow list to be rejected")
+	}
+
+	// Test case: Configured schemes replace the defaults
+	if err := policy.Check("http://example.com/", ""); err == nil {
+		t.Error("Expected http to be rejected when only https is allowed")
+	}
+}
@@ -0,0 +1,105 @@
+package useragent
+
+import (
+	"strings"
+)
+
+// Operating systems reported by Parse
+const (
+	OSiOS      = "ios"
+	OSAndroid  = "android"
+	OSWindows  = "windows"
+	OSMacOS    = "macos"
+	OSLinux    = "linux"
+	OSChromeOS = "chromeos"
+)
+
+// Device classes reported by Parse
+const (
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+)
+
+// botMarkers are substrings of lower-cased User-Agent headers sent by
+// crawlers, link preview fetchers and HTTP libraries
+var botMarkers = []string{
+	"bot", "crawl", "spider", "slurp", "facebookexternalhit", "whatsapp", "embedly",
+	"headlesschrome", "curl/", "wget/", "python-requests", "go-http-client",
+}
+
+// Info describes the client behind a User-Agent header. Fields are empty
+// when they cannot be told from the header.
+type Info struct {
+	OS     string // One of the OS constants
+	Device string // One of the Device constants
+	Bot    bool   // Whether the client is an automated agent
+}
+
+// Parse extracts the operating system, device class and bot status from a
+// User-Agent header. iPads that request desktop sites identify as macOS
+// and cannot be told apart from Macs.
+func Parse(userAgent string) Info {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return Info{}
+	}
+
+	var info Info
+	for _, marker := range botMarkers {
+		if strings.Contains(ua, marker) {
+			info.Bot = true
+			break
+		}
+	}
+
+	// Order matters: iOS claims to be "like Mac OS X", Android and Chrome OS
+	// run on Linux, and Windows Phone mentions Android and iPhone
+	switch {
+	case strings.Contains(ua, "windows phone"):
+		info.OS = OSWindows
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		info.OS = OSiOS
+	case strings.Contains(ua, "android"):
+		info.OS = OSAndroid
+	case strings.Contains(ua, "cros "):
+		info.OS = OSChromeOS
+	case strings.Contains(ua, "windows"):
+		info.OS = OSWindows
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		info.OS = OSMacOS
+	case strings.Contains(ua, "linux"):
+		info.OS = OSLinux
+	}
+
+	// Android tablets leave "Mobile" out of their User-Agent
+	switch {
+	case strings.Contains(ua, "ipad"), strings.Contains(ua, "tablet"), strings.Contains(ua, "kindle"), strings.Contains(ua, "silk/"),
+		info.OS == OSAndroid && !strings.Contains(ua, "mobile"):
+		info.Device = DeviceTablet
+	case strings.Contains(ua, "mobi"), strings.Contains(ua, "iphone"), strings.Contains(ua, "ipod"):
+		info.Device = DeviceMobile
+	default:
+		info.Device = DeviceDesktop
+	}
+	return info
+}
+
+// KnownOS reports whether os is one of the operating systems Parse reports
+func KnownOS(os string) bool {
+	switch os {
+	case OSiOS, OSAndroid, OSWindows, OSMacOS, OSLinux, OSChromeOS:
+		return true
+	}
+	return false
+}
+
+// KnownDevice reports whether device is one of the device classes Parse
+// reports
+func KnownDevice(device string) bool {
+	switch device {
+	case DeviceMobile, DeviceTablet, DeviceDesktop:
+		return true
+	}
+	return false
+}
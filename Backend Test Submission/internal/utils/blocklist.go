@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrShortcodeReserved is returned for shortcodes that would shadow a
+	// route owned by the service itself
+	ErrShortcodeReserved = errors.New("shortcode is reserved")
+
+	// ErrShortcodeBlocked is returned for shortcodes containing a word on
+	// the blocklist
+	ErrShortcodeBlocked = errors.New("shortcode contains a blocked word")
+)
+
+// ReservedShortcodes lists paths the service serves itself or may serve in
+// the future. They are matched case-insensitively against the whole code.
+var ReservedShortcodes = []string{
+	"admin", "api", "favicon", "health", "healthz", "index", "login", "logout",
+	"metrics", "readyz", "robots", "shorturls", "static",
+}
+
+// leetspeak maps look-alike digits and symbols to the letters they stand
+// for. "1" is ambiguous, so it is tried as both "i" and "l".
+var (
+	leetspeakI = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "9", "g", "@", "a", "$", "s", "!", "i")
+	leetspeakL = strings.NewReplacer("0", "o", "1", "l", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "9", "g", "@", "a", "$", "s", "!", "i")
+)
+
+// Blocklist rejects reserved shortcodes and shortcodes containing unwanted
+// words, including leetspeak spellings such as "w0rd" or "w-o-r-d"
+type Blocklist struct {
+	reserved map[string]bool
+	words    []string
+}
+
+// NewBlocklist creates a Blocklist of the built-in reserved shortcodes plus
+// the given words
+func NewBlocklist(words []string) *Blocklist {
+	b := &Blocklist{reserved: make(map[string]bool)}
+	for _, code := range ReservedShortcodes {
+		b.reserved[code] = true
+	}
+	for _, word := range words {
+		if word = normalizeBlockedWord(word); word != "" {
+			b.words = append(b.words, word)
+		}
+	}
+	return b
+}
+
+// LoadBlocklist creates a Blocklist from a word list file with one word per
+// line. Blank lines and lines starting with # are ignored.
+func LoadBlocklist(path string) (*Blocklist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open blocklist: %w", err)
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read blocklist: %w", err)
+	}
+
+	return NewBlocklist(words), nil
+}
+
+// Check returns ErrShortcodeReserved or ErrShortcodeBlocked if shortcode
+// may not be used, and nil otherwise
+func (b *Blocklist) Check(shortcode string) error {
+	if b.reserved[strings.ToLower(shortcode)] {
+		return ErrShortcodeReserved
+	}
+
+	for _, variant := range leetspeakVariants(shortcode) {
+		for _, word := range b.words {
+			if strings.Contains(variant, word) {
+				return ErrShortcodeBlocked
+			}
+		}
+	}
+	return nil
+}
+
+// leetspeakVariants returns the plain-letter readings of shortcode with
+// separators removed
+func leetspeakVariants(shortcode string) []string {
+	stripped := strings.NewReplacer("-", "", "_", "", ".", "").Replace(strings.ToLower(shortcode))
+	return []string{leetspeakI.Replace(stripped), leetspeakL.Replace(stripped)}
+}
+
+// normalizeBlockedWord brings a word list entry into the form matched by
+// Check
+func normalizeBlockedWord(word string) string {
+	word = strings.NewReplacer("-", "", "_", "", ".", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(word)))
+	return leetspeakI.Replace(word)
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlocklist(t *testing.T) {
+	// Setup
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	os.WriteFile(path, []byte("# unwanted words\nbadword\n\nhell\n"), 0o644)
+
+	blocklist, err := LoadBlocklist(path)
+	if err != nil {
+		t.Fatalf("Failed to load blocklist: %v", err)
+	}
+
+	tests := []struct {
+		shortcode string
+		want      error
+	}{
+		{"promo", nil},
+		{"Static", ErrShortcodeReserved},
+		{"shorturls", ErrShortcodeReserved},
+		{"staticfiles", nil},
+		{"xbadwordx", ErrShortcodeBlocked},
+		{"B4dW0rd", ErrShortcodeBlocked},
+		{"bad-word", ErrShortcodeBlocked},
+		{"he11o", ErrShortcodeBlocked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.shortcode, func(t *testing.T) {
+			if got := blocklist.Check(tt.shortcode); got != tt.want {
+				t.Errorf("Expected Check(%q) = %v, got %v", tt.shortcode, tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidDuration is returned for strings that are not ISO-8601 durations
+var ErrInvalidDuration = errors.New("invalid ISO-8601 duration")
+
+// ISODuration is an ISO-8601 duration such as "P1Y2M3DT4H5M6S" or "P2W".
+// Years, months and days are calendar units, so their length depends on
+// the time they are added to.
+type ISODuration struct {
+	Years, Months, Days int
+	Clock               time.Duration // Hours, minutes and seconds
+}
+
+// Designators in the order they must appear in, before and after the "T"
+const (
+	dateDesignators = "YMWD"
+	timeDesignators = "HMS"
+)
+
+// ParseISODuration parses an ISO-8601 duration. Each designator may appear
+// once, in order, after an unsigned whole number; only seconds may have a
+// fraction.
+func ParseISODuration(s string) (ISODuration, error) {
+	invalid := fmt.Errorf("%w: %q", ErrInvalidDuration, s)
+	rest, found := strings.CutPrefix(s, "P")
+	if !found || rest == "" || strings.HasSuffix(rest, "T") {
+		return ISODuration{}, invalid
+	}
+
+	var d ISODuration
+	var weeks, days int64
+	inTime := false
+	designators := dateDesignators
+	for rest != "" {
+		if rest[0] == 'T' {
+			if inTime {
+				return ISODuration{}, invalid
+			}
+			inTime = true
+			designators = timeDesignators
+			rest = rest[1:]
+			continue
+		}
+
+		// Split off the next number and its unit designator, which must come
+		// after the ones already seen
+		end := strings.IndexFunc(rest, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+		if end <= 0 {
+			return ISODuration{}, invalid
+		}
+		number, unit := rest[:end], rest[end]
+		position := strings.IndexByte(designators, unit)
+		if position < 0 {
+			return ISODuration{}, invalid
+		}
+		designators = designators[position+1:]
+		rest = rest[end+1:]
+
+		if inTime && unit == 'S' {
+			seconds, ok := parseSeconds(number)
+			if !ok || seconds >= float64(math.MaxInt64-d.Clock)/float64(time.Second) {
+				return ISODuration{}, invalid
+			}
+			d.Clock += time.Duration(seconds * float64(time.Second))
+			continue
+		}
+
+		// Bounding numbers keeps the date arithmetic from overflowing;
+		// larger values are beyond any representable expiry anyway
+		n, err := strconv.ParseUint(number, 10, 31)
+		if err != nil {
+			return ISODuration{}, invalid
+		}
+		switch {
+		case inTime:
+			if time.Duration(n) > (math.MaxInt64-d.Clock)/clockUnit(unit) {
+				return ISODuration{}, invalid
+			}
+			d.Clock += time.Duration(n) * clockUnit(unit)
+		case unit == 'Y':
+			d.Years = int(n)
+		case unit == 'M':
+			d.Months = int(n)
+		case unit == 'W':
+			weeks = int64(n)
+		case unit == 'D':
+			days = int64(n)
+		}
+	}
+
+	days += 7 * weeks
+	if days > math.MaxInt32 {
+		return ISODuration{}, invalid
+	}
+	d.Days = int(days)
+	return d, nil
+}
+
+// parseSeconds parses an unsigned number of seconds with an optional
+// decimal fraction
+func parseSeconds(number string) (float64, bool) {
+	whole, fraction, _ := strings.Cut(number, ".")
+	if whole == "" || strings.Contains(fraction, ".") || strings.HasSuffix(number, ".") {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(number, 64)
+	return seconds, err == nil
+}
+
+// clockUnit returns the length of the time designator unit, or a second for
+// units that are not hours or minutes
+func clockUnit(unit byte) time.Duration {
+	switch unit {
+	case 'H':
+		return time.Hour
+	case 'M':
+		return time.Minute
+	}
+	return time.Second
+}
+
+// AddTo returns t advanced by d
+func (d ISODuration) AddTo(t time.Time) time.Time {
+	return t.AddDate(d.Years, d.Months, d.Days).Add(d.Clock)
+}
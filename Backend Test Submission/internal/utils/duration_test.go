@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseISODuration(t *testing.T) {
+	start := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		input string
+		want  time.Time
+		valid bool
+	}{
+		{"Days", "P7D", start.AddDate(0, 0, 7), true},
+		{"Weeks", "P2W", start.AddDate(0, 0, 14), true},
+		{"Hours and minutes", "PT1H30M", start.Add(90 * time.Minute), true},
+		{"Fractional seconds", "PT1.5S", start.Add(1500 * time.Millisecond), true},
+		{"Calendar months", "P1M", start.AddDate(0, 1, 0), true},
+		{"Combined", "P1Y2M3DT4H5M6S", start.AddDate(1, 2, 3).Add(4*time.Hour + 5*time.Minute + 6*time.Second), true},
+		{"Empty", "", time.Time{}, false},
+		{"Only designator", "P", time.Time{}, false},
+		{"Trailing T", "P1DT", time.Time{}, false},
+		{"Missing P", "1D", time.Time{}, false},
+		{"Hours without T", "P1H", time.Time{}, false},
+		{"Negative", "P-1D", time.Time{}, false},
+		{"Missing number", "PTM", time.Time{}, false},
+		{"Go duration", "30m", time.Time{}, false},
+		{"Overflowing hours", "PT99999999999H", time.Time{}, false},
+		{"Overflowing seconds", "PT9999999999999S", time.Time{}, false},
+		{"Overflowing years", "P99999999999Y", time.Time{}, false},
+		{"Overflowing weeks and days", "P2147483647W1D", time.Time{}, false},
+		{"Wrapping years", "P" + strings.Repeat("2147483647Y", 272) + "438497270Y", time.Time{}, false},
+		{"Repeated designator", "P1D1D", time.Time{}, false},
+		{"Repeated time designator", "PT1H1H", time.Time{}, false},
+		{"Time out of order", "PT5S1H", time.Time{}, false},
+		{"Date out of order", "P1M1Y", time.Time{}, false},
+		{"Days before weeks", "P1D1W", time.Time{}, false},
+		{"Plus sign", "P+1D", time.Time{}, false},
+		{"Signed seconds", "PT+1S", time.Time{}, false},
+		{"Exponent", "PT1e3S", time.Time{}, false},
+		{"Hexadecimal", "PT0x10S", time.Time{}, false},
+		{"NaN seconds", "PTNaNS", time.Time{}, false},
+		{"Infinite seconds", "PTInfS", time.Time{}, false},
+		{"Fractional days", "P1.5D", time.Time{}, false},
+		{"Fractional minutes", "PT1.5M", time.Time{}, false},
+		{"Bare fraction", "PT.5S", time.Time{}, false},
+		{"Trailing point", "PT1.S", time.Time{}, false},
+		{"Seconds in date", "P1S", time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := ParseISODuration(tt.input)
+			if (err == nil) != tt.valid {
+				t.Fatalf("Expected valid=%v for %q, got error %v", tt.valid, tt.input, err)
+			}
+			if tt.valid && !d.AddTo(start).Equal(tt.want) {
+				t.Errorf("Expected %q to end at %v, got %v", tt.input, tt.want, d.AddTo(start))
+			}
+		})
+	}
+}
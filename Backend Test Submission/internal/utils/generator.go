@@ -0,0 +1,365 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync/atomic"
+)
+
+// Shortcode generation strategies accepted by NewGenerator
+const (
+	// StrategyRandom produces cryptographically random codes
+	StrategyRandom = "random"
+
+	// StrategySequential encodes an incrementing counter in base62
+	StrategySequential = "sequential"
+
+	// StrategyHashids encodes an incrementing counter with a salted,
+	// shuffled alphabet so consecutive codes do not look consecutive
+	StrategyHashids = "hashids"
+
+	// StrategyHash derives the code from a hash of the destination URL
+	StrategyHash = "hash"
+
+	// StrategyReadable produces random codes from UnambiguousAlphabet
+	StrategyReadable = "readable"
+
+	// StrategyWords produces pronounceable codes such as "brave-otter-42"
+	StrategyWords = "words"
+)
+
+// Base62Alphabet is the alphabet used by the counter and hash strategies
+const Base62Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// Generator produces candidate shortcodes for new short URLs. Callers must
+// still reserve the code with the store, retrying with a longer length on
+// collision.
+type Generator interface {
+	// Generate returns a shortcode of the given length for originalURL
+	Generate(originalURL string, length int) (string, error)
+}
+
+// GeneratorFunc adapts an ordinary function to the Generator interface
+type GeneratorFunc func(originalURL string, length int) (string, error)
+
+// Generate calls f(originalURL, length)
+func (f GeneratorFunc) Generate(originalURL string, length int) (string, error) {
+	return f(originalURL, length)
+}
+
+// RetryGenerator is implemented by generators whose codes depend only on
+// their input. Asking them again after a collision would return the same
+// code, so retries call Retry instead.
+type RetryGenerator interface {
+	Generator
+
+	// Retry returns a shortcode of the given length for originalURL that
+	// differs from the one Generate returns
+	Retry(originalURL string, length int) (string, error)
+}
+
+// GeneratorConfig selects and configures a shortcode generation strategy
+type GeneratorConfig struct {
+	// Strategy is one of the Strategy* constants (defaults to StrategyRandom)
+	Strategy string
+
+	// Salt personalizes the hashids alphabet; keep it secret and stable
+	Salt string
+
+	// Start is the first counter value used by the counter strategies
+	Start uint64
+
+	// CaseInsensitive restricts codes to FoldAlphabet of the strategy's
+	// alphabet, for handlers that fold shortcodes to lower case
+	CaseInsensitive bool
+}
+
+// NewGenerator creates the Generator described by config
+func NewGenerator(config GeneratorConfig) (Generator, error) {
+	base62, unambiguous := Base62Alphabet, UnambiguousAlphabet
+	if config.CaseInsensitive {
+		base62, unambiguous = FoldAlphabet(base62), FoldAlphabet(unambiguous)
+	}
+
+	switch config.Strategy {
+	case "", StrategyRandom:
+		return RandomGenerator{}, nil
+	case StrategySequential:
+		return newSequentialGenerator(base62, config.Start), nil
+	case StrategyHashids:
+		return newHashidsGenerator(base62, config.Salt, config.Start), nil
+	case StrategyHash:
+		return HashGenerator{Alphabet: base62}, nil
+	case StrategyReadable:
+		return ReadableGenerator{Alphabet: unambiguous}, nil
+	case StrategyWords:
+		return WordGenerator{}, nil
+	default:
+		return nil, fmt.Errorf("unknown shortcode strategy %q", config.Strategy)
+	}
+}
+
+// RandomGenerator produces random shortcodes with GenerateShortcode. Its
+// codes only lose case distinctions when folded to lower case, so it needs
+// no folded alphabet.
+type RandomGenerator struct{}
+
+// Generate returns a random shortcode of the given length
+func (RandomGenerator) Generate(_ string, length int) (string, error) {
+	return GenerateShortcode(length)
+}
+
+// SequentialGenerator encodes an in-process counter in base62, left-padded
+// to the requested length. The counter is not persisted, so after a
+// restart the store's collision handling skips codes that are already used.
+type SequentialGenerator struct {
+	counter  atomic.Uint64
+	alphabet string
+}
+
+// NewSequentialGenerator creates a SequentialGenerator whose first code
+// encodes start
+func NewSequentialGenerator(start uint64) *SequentialGenerator {
+	return newSequentialGenerator(Base62Alphabet, start)
+}
+
+// newSequentialGenerator creates a SequentialGenerator encoding its counter
+// with alphabet
+func newSequentialGenerator(alphabet string, start uint64) *SequentialGenerator {
+	g := &SequentialGenerator{alphabet: alphabet}
+	g.counter.Store(start)
+	return g
+}
+
+// Generate returns the code for the next counter value
+func (g *SequentialGenerator) Generate(_ string, length int) (string, error) {
+	n := g.counter.Add(1) - 1
+	return encodeFixedWidth(n, g.alphabet, length)
+}
+
+// HashidsGenerator obfuscates an in-process counter in the style of
+// hashids: the first character is a "lottery" character that selects one of
+// several salted alphabet permutations, and the counter is encoded with that
+// permutation. Codes stay unique and decodable while hiding the sequence.
+type HashidsGenerator struct {
+	counter  atomic.Uint64
+	alphabet string
+	salt     string
+}
+
+// NewHashidsGenerator creates a HashidsGenerator keyed by salt whose first
+// code encodes start
+func NewHashidsGenerator(salt string, start uint64) *HashidsGenerator {
+	return newHashidsGenerator(Base62Alphabet, salt, start)
+}
+
+// newHashidsGenerator creates a HashidsGenerator that shuffles alphabet
+func newHashidsGenerator(alphabet, salt string, start uint64) *HashidsGenerator {
+	g := &HashidsGenerator{
+		alphabet: consistentShuffle(alphabet, salt),
+		salt:     salt,
+	}
+	g.counter.Store(start)
+	return g
+}
+
+// Generate returns the obfuscated code for the next counter value
+func (g *HashidsGenerator) Generate(_ string, length int) (string, error) {
+	if length < 2 {
+		length = 2
+	}
+
+	n := g.counter.Add(1) - 1
+	lottery := g.alphabet[n%uint64(len(g.alphabet))]
+	alphabet := consistentShuffle(g.alphabet, string(lottery)+g.salt)
+
+	encoded, err := encodeFixedWidth(n, alphabet, length-1)
+	if err != nil {
+		return "", err
+	}
+	return string(lottery) + encoded, nil
+}
+
+// HashGenerator derives the shortcode from a SHA-256 hash of the destination
+// URL, so the first link to a URL always gets the same code at a given
+// length
+type HashGenerator struct {
+	// Alphabet encodes the hash (defaults to Base62Alphabet)
+	Alphabet string
+}
+
+// Generate returns the first length characters of the URL's hash
+func (g HashGenerator) Generate(originalURL string, length int) (string, error) {
+	return hashShortcode(originalURL, g.Alphabet, length)
+}
+
+// Retry hashes the URL together with a random nonce. Any fixed sequence of
+// codes would run out once the same URL has been shortened often enough.
+func (g HashGenerator) Retry(originalURL string, length int) (string, error) {
+	nonce, err := GenerateShortcode(16)
+	if err != nil {
+		return "", err
+	}
+	return hashShortcode(originalURL+"\n"+nonce, g.Alphabet, length)
+}
+
+// hashShortcode returns the first length characters of the hash of input
+// written with alphabet (Base62Alphabet if empty)
+func hashShortcode(input, alphabet string, length int) (string, error) {
+	if length <= 0 {
+		length = DefaultShortcodeLength
+	}
+	if alphabet == "" {
+		alphabet = Base62Alphabet
+	}
+
+	sum := sha256.Sum256([]byte(input))
+	n := new(big.Int).SetBytes(sum[:])
+	base := big.NewInt(int64(len(alphabet)))
+
+	code := make([]byte, 0, length)
+	mod := new(big.Int)
+	for len(code) < length && n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		code = append(code, alphabet[mod.Int64()])
+	}
+	if len(code) < length {
+		return "", fmt.Errorf("hash too short for a %d character shortcode", length)
+	}
+	return string(code), nil
+}
+
+// ReadableGenerator produces random shortcodes that avoid characters which
+// are easily confused when read aloud or printed
+type ReadableGenerator struct {
+	// Alphabet supplies the characters (defaults to UnambiguousAlphabet)
+	Alphabet string
+}
+
+// Generate returns a random shortcode of the given length drawn from the
+// generator's alphabet
+func (g ReadableGenerator) Generate(_ string, length int) (string, error) {
+	if length <= 0 {
+		length = DefaultShortcodeLength
+	}
+	alphabet := g.Alphabet
+	if alphabet == "" {
+		alphabet = UnambiguousAlphabet
+	}
+
+	code := make([]byte, length)
+	for i := range code {
+		index, err := randomIndex(len(alphabet))
+		if err != nil {
+			return "", err
+		}
+		code[i] = alphabet[index]
+	}
+	return string(code), nil
+}
+
+// Word lists for WordGenerator. Words are short, lowercase and unambiguous
+// when spoken.
+var (
+	shortcodeAdjectives = []string{
+		"agile", "amber", "brave", "brisk", "calm", "clever", "cosmic", "crisp",
+		"daring", "eager", "fancy", "fluffy", "gentle", "giant", "golden", "happy",
+		"humble", "jolly", "kind", "lively", "lucky", "mellow", "merry", "mighty",
+		"nimble", "noble", "plucky", "polite", "proud", "quick", "quiet", "rapid",
+		"rosy", "royal", "rustic", "shiny", "silent", "silver", "sleek", "smart",
+		"snowy", "solar", "spicy", "steady", "sunny", "super", "swift", "tidy",
+		"tiny", "vivid", "warm", "wild", "windy", "wise", "witty", "zesty",
+	}
+	shortcodeNouns = []string{
+		"badger", "bear", "beaver", "bison", "canyon", "cedar", "comet", "coral",
+		"crane", "dolphin", "eagle", "falcon", "fern", "forest", "fox", "gecko",
+		"harbor", "hawk", "heron", "island", "jaguar", "koala", "lagoon", "lemur",
+		"lynx", "maple", "meadow", "moose", "nebula", "otter", "owl", "panda",
+		"parrot", "pebble", "penguin", "pine", "planet", "puffin", "rabbit", "raven",
+		"river", "robin", "salmon", "seal", "sparrow", "spruce", "summit", "swan",
+		"tiger", "tulip", "turtle", "valley", "walrus", "willow", "wombat", "zebra",
+	}
+)
+
+// WordGenerator produces pronounceable shortcodes such as "brave-otter-42".
+// Each extra character of requested length beyond DefaultShortcodeLength
+// adds a digit to the numeric suffix, widening the space after collisions.
+type WordGenerator struct{}
+
+// Generate returns an adjective-noun-number shortcode
+func (WordGenerator) Generate(_ string, length int) (string, error) {
+	digits := 2
+	if length > DefaultShortcodeLength {
+		digits += length - DefaultShortcodeLength
+	}
+
+	adjective, err := randomIndex(len(shortcodeAdjectives))
+	if err != nil {
+		return "", err
+	}
+	noun, err := randomIndex(len(shortcodeNouns))
+	if err != nil {
+		return "", err
+	}
+
+	var suffix strings.Builder
+	for i := 0; i < digits; i++ {
+		digit, err := randomIndex(10)
+		if err != nil {
+			return "", err
+		}
+		suffix.WriteByte(byte('0' + digit))
+	}
+
+	return shortcodeAdjectives[adjective] + "-" + shortcodeNouns[noun] + "-" + suffix.String(), nil
+}
+
+// randomIndex returns a uniformly distributed random integer in [0, n)
+func randomIndex(n int) (int, error) {
+	index, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(index.Int64()), nil
+}
+
+// encodeFixedWidth writes n in the positional system given by alphabet,
+// left-padded with alphabet[0] to width characters. Distinct values always
+// produce distinct codes of the same width.
+func encodeFixedWidth(n uint64, alphabet string, width int) (string, error) {
+	if width <= 0 {
+		width = DefaultShortcodeLength
+	}
+
+	base := uint64(len(alphabet))
+	code := make([]byte, width)
+	for i := width - 1; i >= 0; i-- {
+		code[i] = alphabet[n%base]
+		n /= base
+	}
+	if n > 0 {
+		return "", fmt.Errorf("counter does not fit in %d characters", width)
+	}
+	return string(code), nil
+}
+
+// consistentShuffle permutes alphabet deterministically from salt, using the
+// same algorithm as hashids
+func consistentShuffle(alphabet, salt string) string {
+	if salt == "" {
+		return alphabet
+	}
+
+	shuffled := []byte(alphabet)
+	for i, v, p := len(shuffled)-1, 0, 0; i > 0; i-- {
+		v %= len(salt)
+		p += int(salt[v])
+		j := (int(salt[v]) + v + p) % i
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		v++
+	}
+	return string(shuffled)
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestNewGenerator(t *testing.T) {
+	for _, strategy := range []string{"", StrategyRandom, StrategySequential, StrategyHashids, StrategyHash} {
+		generator, err := NewGenerator(GeneratorConfig{Strategy: strategy, Salt: "salt"})
+		if err != nil {
+			t.Fatalf("Failed to create %q generator: %v", strategy, err)
+		}
+
+		code, err := generator.Generate("https://example.com", DefaultShortcodeLength)
+		if err != nil {
+			t.Fatalf("Failed to generate with %q: %v", strategy, err)
+		}
+		if len(code) != DefaultShortcodeLength || !ValidateShortcode(code) {
+			t.Errorf("Expected a valid %d character code from %q, got %q", DefaultShortcodeLength, strategy, code)
+		}
+	}
+
+	// Folded codes must be valid as generated, without wasting attempts
+	for _, strategy := range []string{StrategySequential, StrategyHashids, StrategyHash, StrategyReadable} {
+		generator, _ := NewGenerator(GeneratorConfig{Strategy: strategy, Salt: "salt", Start: 1 << 25, CaseInsensitive: true})
+		validator := ValidatorForStrategy(strategy, true)
+		for i := 0; i < 20; i++ {
+			code, err := generator.Generate(fmt.Sprintf("https://example.com/%d", i), DefaultShortcodeLength)
+			if err != nil {
+				t.Fatalf("Failed to generate with %q: %v", strategy, err)
+			}
+			if !validator.Validate(code) {
+				t.Errorf("Expected a case-insensitive code from %q, got %q", strategy, code)
+			}
+		}
+	}
+
+	if _, err := NewGenerator(GeneratorConfig{Strategy: "unknown"}); err == nil {
+		t.Error("Expected an error for an unknown strategy")
+	}
+}
+
+func TestSequentialGenerator(t *testing.T) {
+	generator := NewSequentialGenerator(61)
+
+	first, _ := generator.Generate("", 4)
+	second, _ := generator.Generate("", 4)
+	if first != "000Z" || second != "0010" {
+		t.Errorf("Expected 000Z then 0010, got %s then %s", first, second)
+	}
+}
+
+func TestHashidsGenerator(t *testing.T) {
+	generator := NewHashidsGenerator("salt", 0)
+
+	// Codes must be unique and must not reveal the counter
+	seen := make(map[string]bool)
+	for i := 0; i < 10000; i++ {
+		code, err := generator.Generate("", DefaultShortcodeLength)
+		if err != nil {
+			t.Fatalf("Failed to generate: %v", err)
+		}
+		if seen[code] {
+			t.Fatalf("Duplicate code %s after %d codes", code, i)
+		}
+		seen[code] = true
+	}
+
+	other, _ := NewHashidsGenerator("pepper", 0).Generate("", DefaultShortcodeLength)
+	first, _ := NewHashidsGenerator("salt", 0).Generate("", DefaultShortcodeLength)
+	if other == first {
+		t.Error("Expected different salts to produce different codes")
+	}
+}
+
+func TestHashGenerator(t *testing.T) {
+	generator := HashGenerator{}
+
+	a, _ := generator.Generate("https://example.com", DefaultShortcodeLength)
+	b, _ := generator.Generate("https://example.com", DefaultShortcodeLength)
+	c, _ := generator.Generate("https://example.org", DefaultShortcodeLength)
+	if a != b {
+		t.Errorf("Expected the same URL to produce the same code, got %s and %s", a, b)
+	}
+	if a == c {
+		t.Errorf("Expected different URLs to produce different codes, got %s", a)
+	}
+
+	longer, _ := generator.Generate("https://example.com", DefaultShortcodeLength+1)
+	if longer == a {
+		t.Error("Expected a longer code after a collision")
+	}
+
+	// Retries must not repeat the code that collided
+	retried, _ := generator.Retry("https://example.com", DefaultShortcodeLength)
+	again, _ := generator.Retry("https://example.com", DefaultShortcodeLength)
+	if retried == a || retried == again || len(retried) != DefaultShortcodeLength {
+		t.Errorf("Expected fresh retry codes, got %s, %s and %s", a, retried, again)
+	}
+}
+
+func TestReadableGenerator(t *testing.T) {
+	validator := ValidatorForStrategy(StrategyReadable, false)
+
+	for i := 0; i < 100; i++ {
+		code, err := ReadableGenerator{}.Generate("", DefaultShortcodeLength)
+		if err != nil {
+			t.Fatalf("Failed to generate: %v", err)
+		}
+		if !validator.Validate(code) {
+			t.Fatalf("Expected %q to use only unambiguous characters", code)
+		}
+	}
+}
+
+func TestWordGenerator(t *testing.T) {
+	validator := ValidatorForStrategy(StrategyWords, false)
+
+	code, err := WordGenerator{}.Generate("", DefaultShortcodeLength)
+	if err != nil {
+		t.Fatalf("Failed to generate: %v", err)
+	}
+	if !wordCodePattern.MatchString(code) || !validator.Validate(code) {
+		t.Errorf("Expected an adjective-noun-number code, got %q", code)
+	}
+
+	longer, _ := WordGenerator{}.Generate("", DefaultShortcodeLength+2)
+	if !regexp.MustCompile(`-\d{4}$`).MatchString(longer) {
+		t.Errorf("Expected a longer numeric suffix after collisions, got %q", longer)
+	}
+}
+
+// wordCodePattern matches codes produced by WordGenerator at the default length
+var wordCodePattern = regexp.MustCompile(`^[a-z]+-[a-z]+-\d{2}$`)
@@ -3,8 +3,12 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"regexp"
 	"strings"
+	"sync/atomic"
+	"unicode"
 )
 
 const (
@@ -13,13 +17,154 @@ const (
 
 	// MaxShortcodeLength is the maximum allowed length for custom shortcodes
 	MaxShortcodeLength = 12
+
+	// MaxWordShortcodeLength is the maximum length of shortcodes when
+	// word-based codes such as "brave-otter-42" are enabled
+	MaxWordShortcodeLength = 32
+
+	// DefaultAlphabet lists the characters allowed in shortcodes by default
+	DefaultAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-"
+
+	// UnambiguousAlphabet leaves out characters that are easily confused
+	// when read aloud or printed: 0/O/o and 1/l/I
+	UnambiguousAlphabet = "23456789abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+
+	// WordAlphabet lists the characters that make up word-based shortcodes
+	WordAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789-"
 )
 
 var (
 	// ValidShortcodePattern defines the allowed characters in a shortcode
 	ValidShortcodePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+	// shortcodeValidator is the validator used by ValidateShortcode
+	shortcodeValidator atomic.Pointer[ShortcodeValidator]
 )
 
+// ErrShortcodeInvalid is returned for shortcodes that are empty, too long
+// or use characters outside the configured alphabet
+var ErrShortcodeInvalid = errors.New("invalid shortcode format")
+
+func init() {
+	shortcodeValidator.Store(&ShortcodeValidator{
+		alphabet:  DefaultAlphabet,
+		pattern:   ValidShortcodePattern,
+		maxLength: MaxShortcodeLength,
+		blocklist: NewBlocklist(nil),
+	})
+}
+
+// ShortcodeValidator checks shortcodes against an alphabet, a maximum length
+// and a blocklist
+type ShortcodeValidator struct {
+	alphabet  string
+	pattern   *regexp.Regexp
+	maxLength int
+	blocklist *Blocklist
+}
+
+// NewShortcodeValidator creates a validator accepting shortcodes of up to
+// maxLength characters drawn from alphabet. It rejects the built-in
+// reserved shortcodes until SetBlocklist installs a fuller list.
+func NewShortcodeValidator(alphabet string, maxLength int) *ShortcodeValidator {
+	return &ShortcodeValidator{
+		alphabet:  alphabet,
+		pattern:   regexp.MustCompile(`^[` + characterClass(alphabet) + `]+$`),
+		maxLength: maxLength,
+		blocklist: NewBlocklist(nil),
+	}
+}
+
+// SetBlocklist replaces the blocklist consulted by the validator. It must
+// be called before the validator is shared.
+func (v *ShortcodeValidator) SetBlocklist(blocklist *Blocklist) {
+	v.blocklist = blocklist
+}
+
+// characterClass escapes every punctuation character of alphabet so it can
+// be used verbatim inside a regular expression character class
+func characterClass(alphabet string) string {
+	var b strings.Builder
+	for _, r := range alphabet {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ValidatorForStrategy returns the validator matching the codes produced
+// by a generation strategy, so custom codes follow the same rules. With
+// caseInsensitive, the alphabet is folded like the codes themselves.
+func ValidatorForStrategy(strategy string, caseInsensitive bool) *ShortcodeValidator {
+	alphabet, maxLength := DefaultAlphabet, MaxShortcodeLength
+	switch strategy {
+	case StrategyReadable:
+		alphabet = UnambiguousAlphabet
+	case StrategyWords:
+		alphabet, maxLength = WordAlphabet, MaxWordShortcodeLength
+	}
+	if caseInsensitive {
+		alphabet = FoldAlphabet(alphabet)
+	}
+	return NewShortcodeValidator(alphabet, maxLength)
+}
+
+// FoldAlphabet returns the characters of alphabet that case-insensitive
+// shortcodes, which are stored in lower case, may contain. Upper-case
+// letters are left out rather than lowered, so that an alphabet avoiding
+// "l" and "o" keeps avoiding them.
+func FoldAlphabet(alphabet string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return -1
+		}
+		return r
+	}, alphabet)
+}
+
+// SetShortcodeValidator replaces the validator used by ValidateShortcode.
+// It is meant to be called once during startup.
+func SetShortcodeValidator(v *ShortcodeValidator) {
+	shortcodeValidator.Store(v)
+}
+
+// Check returns ErrShortcodeInvalid, ErrShortcodeReserved or
+// ErrShortcodeBlocked if shortcode may not be used, and nil otherwise
+func (v *ShortcodeValidator) Check(shortcode string) error {
+	// Check if shortcode is empty
+	if shortcode == "" {
+		return ErrShortcodeInvalid
+	}
+
+	// Check if shortcode is too long
+	if len(shortcode) > v.maxLength {
+		return ErrShortcodeInvalid
+	}
+
+	// Check if shortcode contains only allowed characters
+	if !v.pattern.MatchString(shortcode) {
+		return ErrShortcodeInvalid
+	}
+
+	// Check reserved paths and unwanted words
+	if v.blocklist != nil {
+		return v.blocklist.Check(shortcode)
+	}
+	return nil
+}
+
+// Validate checks if a shortcode is valid
+func (v *ShortcodeValidator) Validate(shortcode string) bool {
+	return v.Check(shortcode) == nil
+}
+
+// Requirements describes the accepted shortcodes for error messages
+func (v *ShortcodeValidator) Requirements() string {
+	return fmt.Sprintf("Shortcode must be 1-%d characters from %q", v.maxLength, v.alphabet)
+}
+
 // GenerateShortcode creates a random shortcode of the specified length
 func GenerateShortcode(length int) (string, error) {
 	if length <= 0 {
@@ -45,18 +190,20 @@ func GenerateShortcode(length int) (string, error) {
 	return shortcode, nil
 }
 
-// ValidateShortcode checks if a shortcode is valid
+// ValidateShortcode checks if a shortcode is valid under the configured
+// validator
 func ValidateShortcode(shortcode string) bool {
-	// Check if shortcode is empty
-	if shortcode == "" {
-		return false
-	}
+	return shortcodeValidator.Load().Validate(shortcode)
+}
 
-	// Check if shortcode is too long
-	if len(shortcode) > MaxShortcodeLength {
-		return false
-	}
+// CheckShortcode is like ValidateShortcode but reports why a shortcode was
+// rejected
+func CheckShortcode(shortcode string) error {
+	return shortcodeValidator.Load().Check(shortcode)
+}
 
-	// Check if shortcode contains only allowed characters
-	return ValidShortcodePattern.MatchString(shortcode)
+// ShortcodeRequirements describes the shortcodes accepted by
+// ValidateShortcode
+func ShortcodeRequirements() string {
+	return shortcodeValidator.Load().Requirements()
 }
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateShortcode(t *testing.T) {
+	tests := []struct {
+		name      string
+		validator *ShortcodeValidator
+		shortcode string
+		valid     bool
+	}{
+		{"Default alphabet", ValidatorForStrategy(StrategyRandom, false), "aZ-_9q", true},
+		{"Empty", ValidatorForStrategy(StrategyRandom, false), "", false},
+		{"Too long", ValidatorForStrategy(StrategyRandom, false), "abcdefghijklm", false},
+		{"Invalid character", ValidatorForStrategy(StrategyRandom, false), "a/b", false},
+		{"Unambiguous alphabet", ValidatorForStrategy(StrategyReadable, false), "Xk7pQ2", true},
+		{"Ambiguous characters", ValidatorForStrategy(StrategyReadable, false), "l0Oo1I", false},
+		{"Word code", ValidatorForStrategy(StrategyWords, false), "brave-otter-42", true},
+		{"Word code with uppercase", ValidatorForStrategy(StrategyWords, false), "Brave-Otter-42", false},
+		{"Case-insensitive default", ValidatorForStrategy(StrategyRandom, true), "abc-_9", true},
+		{"Case-insensitive readable", ValidatorForStrategy(StrategyReadable, true), "xk7pq2", true},
+		{"Folded ambiguous characters", ValidatorForStrategy(StrategyReadable, true), "lamp", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetShortcodeValidator(tt.validator)
+			defer SetShortcodeValidator(ValidatorForStrategy(StrategyRandom, false))
+
+			if got := ValidateShortcode(tt.shortcode); got != tt.valid {
+				t.Errorf("Expected ValidateShortcode(%q) = %v, got %v", tt.shortcode, tt.valid, got)
+			}
+		})
+	}
+}
+
+func TestFoldAlphabet(t *testing.T) {
+	if got := FoldAlphabet(UnambiguousAlphabet); got != "23456789abcdefghijkmnpqrstuvwxyz" {
+		t.Errorf("Expected lower-case unambiguous alphabet, got %q", got)
+	}
+
+	requirements := ValidatorForStrategy(StrategyReadable, true).Requirements()
+	if !strings.HasSuffix(requirements, `from "23456789abcdefghijkmnpqrstuvwxyz"`) {
+		t.Errorf("Expected requirements to list only lower-case letters, got %q", requirements)
+	}
+}
@@ -1,26 +1,138 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/redis/go-redis/v9"
+
 	"12217467/backend_test_submission/internal/api"
+	"12217467/backend_test_submission/internal/janitor"
 	"12217467/backend_test_submission/internal/middleware"
+	"12217467/backend_test_submission/internal/ratelimit"
+	"12217467/backend_test_submission/internal/reputation"
 	"12217467/backend_test_submission/internal/storage"
+	"12217467/backend_test_submission/internal/urlpolicy"
+	"12217467/backend_test_submission/internal/utils"
 )
 
 func main() {
+	// Stop background work and the server on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize logger
 	logger := middleware.NewLogger()
 
 	// Initialize storage
-	urlStore := storage.NewURLStore()
+	urlStore, closeStore, err := newURLStore()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer closeStore()
+
+	// Start the expiry janitor for stores that do not expire entries themselves
+	if purger, ok := urlStore.(storage.ExpiredPurger); ok {
+		sweeper, err := newJanitor(purger, logger)
+		if err != nil {
+			log.Fatalf("Failed to initialize expiry janitor: %v", err)
+		}
+		if sweeper != nil {
+			expvar.Publish("janitor", expvar.Func(func() interface{} { return sweeper.Stats() }))
+			go sweeper.Run(ctx)
+		}
+	}
+
+	// Initialize shortcode generation; custom shortcodes must follow the
+	// same alphabet as generated ones
+	strategy := os.Getenv("SHORTCODE_STRATEGY")
+	caseInsensitive := os.Getenv("SHORTCODE_CASE_INSENSITIVE") == "true"
+	generator, err := utils.NewGenerator(utils.GeneratorConfig{
+		Strategy:        strategy,
+		Salt:            os.Getenv("SHORTCODE_SALT"),
+		CaseInsensitive: caseInsensitive,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize shortcode generator: %v", err)
+	}
+	validator := utils.ValidatorForStrategy(strategy, caseInsensitive)
+	if path := os.Getenv("SHORTCODE_BLOCKLIST_FILE"); path != "" {
+		blocklist, err := utils.LoadBlocklist(path)
+		if err != nil {
+			log.Fatalf("Failed to load shortcode blocklist: %v", err)
+		}
+		validator.SetBlocklist(blocklist)
+	}
+	utils.SetShortcodeValidator(validator)
 
 	// Initialize API handlers
-	handler := api.NewHandler(urlStore, logger)
+	handlerOptions := []api.Option{
+		api.WithGenerator(generator),
+		api.WithURLPolicy(urlpolicy.New(urlpolicy.Config{
+			AllowedSchemes: listEnv("URL_ALLOWED_SCHEMES"),
+			SelfHosts:      listEnv("URL_SELF_HOSTS"),
+			AllowHosts:     listEnv("URL_ALLOW_HOSTS"),
+			DenyHosts:      listEnv("URL_DENY_HOSTS"),
+		})),
+	}
+	if caseInsensitive {
+		handlerOptions = append(handlerOptions, api.WithCaseInsensitiveShortcodes())
+	}
+	pages, err := api.LoadPages("static")
+	if err != nil {
+		log.Fatalf("Failed to load page templates: %v", err)
+	}
+	handlerOptions = append(handlerOptions, api.WithPages(pages))
+	checker, action, err := newURLChecker()
+	if err != nil {
+		log.Fatalf("Failed to initialize URL reputation checks: %v", err)
+	}
+	if checker != nil {
+		handlerOptions = append(handlerOptions, api.WithURLChecker(checker, action))
+	}
+	maxValidity, err := durationEnv("MAX_VALIDITY", 0)
+	if err != nil {
+		log.Fatalf("Failed to configure expiry policy: %v", err)
+	}
+	handlerOptions = append(handlerOptions, api.WithExpiryPolicy(api.ExpiryPolicy{
+		MaxValidity:       maxValidity,
+		AllowNeverExpires: os.Getenv("ALLOW_NEVER_EXPIRES") == "true",
+	}))
+	switch status := os.Getenv("NOT_ACTIVE_STATUS"); status {
+	case "", "425":
+	case "404":
+		handlerOptions = append(handlerOptions, api.WithNotActiveStatus(http.StatusNotFound))
+	default:
+		log.Fatalf("Invalid NOT_ACTIVE_STATUS %q: must be 425 or 404", status)
+	}
+	if fallback := os.Getenv("DEFAULT_FALLBACK_URL"); fallback != "" {
+		if u, err := url.ParseRequestURI(fallback); err != nil || u.Host == "" {
+			log.Fatalf("Invalid DEFAULT_FALLBACK_URL %q: must be an absolute URL", fallback)
+		}
+		handlerOptions = append(handlerOptions, api.WithDefaultFallbackURL(fallback))
+	}
+	passwordOptions, err := newPasswordOptions(logger)
+	if err != nil {
+		log.Fatalf("Failed to initialize password protection: %v", err)
+	}
+	handlerOptions = append(handlerOptions, passwordOptions...)
+	if os.Getenv("AUTH_REQUIRED") == "true" {
+		if os.Getenv("API_KEYS_FILE") == "" && os.Getenv("JWT_JWKS_FILE") == "" {
+			log.Fatal("AUTH_REQUIRED needs API_KEYS_FILE or JWT_JWKS_FILE to be set")
+		}
+		handlerOptions = append(handlerOptions, api.WithAuthRequired())
+	}
+	handler := api.NewHandler(urlStore, logger, handlerOptions...)
 
 	// Create router and register routes
 	mux := http.NewServeMux()
@@ -35,10 +147,20 @@ func main() {
 	})
 
 	mux.HandleFunc("/shorturls/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet && r.URL.Path != "/shorturls/" {
-			// The handler will extract the shortcode from the path
+		if r.URL.Path == "/shorturls/" {
+			http.Error(w, "Method not allowed or invalid path", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The handlers will extract the shortcode from the path
+		switch r.Method {
+		case http.MethodGet:
 			handler.GetURLStats(w, r)
-		} else {
+		case http.MethodPatch:
+			handler.UpdateShortURL(w, r)
+		case http.MethodDelete:
+			handler.DeleteShortURL(w, r)
+		default:
 			http.Error(w, "Method not allowed or invalid path", http.StatusMethodNotAllowed)
 		}
 	})
@@ -52,6 +174,9 @@ func main() {
 		if r.Method == http.MethodGet && r.URL.Path != "/" {
 			// This handles all paths except the root path
 			handler.RedirectURL(w, r)
+		} else if r.Method == http.MethodPost && r.URL.Path != "/" {
+			// Password form of protected links
+			handler.UnlockURL(w, r)
 		} else if r.URL.Path == "/" {
 			// Serve the index.html file for the root path
 			http.ServeFile(w, r, "static/index.html")
@@ -60,8 +185,40 @@ func main() {
 		}
 	})
 
+	// Apply rate limiting; it runs after authentication so that
+	// authenticated clients are limited per principal
+	var routes http.Handler = mux
+	limiter, err := newRateLimiter(logger)
+	if err != nil {
+		log.Fatalf("Failed to initialize rate limiter: %v", err)
+	}
+	if limiter != nil {
+		routes = limiter(routes)
+	}
+
+	// Apply authentication middleware
+	if path := os.Getenv("API_KEYS_FILE"); path != "" {
+		keys, err := middleware.LoadFileKeyStore(path)
+		if err != nil {
+			log.Fatalf("Failed to load API keys: %v", err)
+		}
+		routes = middleware.APIKeyAuth(keys, logger)(routes)
+	}
+	if path := os.Getenv("JWT_JWKS_FILE"); path != "" {
+		jwks, err := middleware.LoadJWKS(path)
+		if err != nil {
+			log.Fatalf("Failed to load JWKS: %v", err)
+		}
+		verifier := middleware.NewJWTVerifier(jwks, middleware.JWTConfig{
+			Issuer:   os.Getenv("JWT_ISSUER"),
+			Audience: os.Getenv("JWT_AUDIENCE"),
+			Leeway:   time.Minute,
+		})
+		routes = middleware.JWTAuth(verifier, logger)(routes)
+	}
+
 	// Apply logging middleware
-	wrappedMux := middleware.LoggingMiddleware(logger)(mux)
+	wrappedMux := middleware.LoggingMiddleware(logger)(routes)
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -76,8 +233,299 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
-	fmt.Printf("Server starting on port %s...\n", port)
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	serverErr := make(chan error, 1)
+	go func() {
+		fmt.Printf("Server starting on port %s...\n", port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// Serve runtime and janitor counters on a separate, private listener
+	admin := newAdminServer()
+	if admin != nil {
+		go func() {
+			fmt.Printf("Admin server starting on %s...\n", admin.Addr)
+			if err := admin.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("Admin server failed", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}()
+	}
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	case <-ctx.Done():
+		fmt.Println("Shutting down...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Graceful shutdown failed", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		if admin != nil {
+			admin.Shutdown(shutdownCtx)
+		}
+	}
+}
+
+// newAdminServer returns a server for the expvar counters at /debug/vars,
+// listening on ADMIN_ADDR (default "localhost:8001"), or nil if ADMIN_ADDR
+// is "off". The counters include the command line, so the address should
+// not be reachable from outside.
+func newAdminServer() *http.Server {
+	addr := os.Getenv("ADMIN_ADDR")
+	switch addr {
+	case "off":
+		return nil
+	case "":
+		addr = "localhost:8001"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	return &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+}
+
+// newURLStore selects the storage backend from the STORAGE_BACKEND
+// environment variable ("memory" by default, "sqlite", "postgres" or
+// "redis"). The returned
+// function releases any resources held by the store.
+func newURLStore() (storage.URLStore, func() error, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "memory":
+		dir := os.Getenv("MEMORY_PERSIST_DIR")
+		if dir == "" {
+			return storage.NewURLStore(), func() error { return nil }, nil
+		}
+		store, err := storage.NewPersistentURLStore(storage.PersistenceConfig{
+			Dir:        dir,
+			SyncWrites: os.Getenv("MEMORY_PERSIST_SYNC") == "true",
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.Close, nil
+	case "sqlite":
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "shortener.db"
+		}
+		store, err := storage.NewSQLiteURLStore(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.Close, nil
+	case "postgres":
+		dsn := os.Getenv("POSTGRES_DSN")
+		if dsn == "" {
+			return nil, nil, fmt.Errorf("POSTGRES_DSN must be set for the postgres backend")
+		}
+		store, err := storage.NewPostgresURLStore(dsn)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.Close, nil
+	case "redis":
+		client, err := newRedisClient()
+		if err != nil {
+			return nil, nil, err
+		}
+		store := storage.NewRedisURLStore(client, storage.RedisStoreConfig{
+			ExpiredRetention: 24 * time.Hour,
+		})
+		return store, store.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// newJanitor configures the expiry janitor from the environment:
+// JANITOR_INTERVAL and JANITOR_GRACE_PERIOD take Go durations ("off" as the
+// interval disables the janitor), and JANITOR_ARCHIVE_FILE archives purged
+// entries as JSON lines instead of discarding them.
+func newJanitor(purger storage.ExpiredPurger, logger middleware.Logger) (*janitor.Janitor, error) {
+	if os.Getenv("JANITOR_INTERVAL") == "off" {
+		return nil, nil
+	}
+
+	interval, err := durationEnv("JANITOR_INTERVAL", janitor.DefaultInterval)
+	if err != nil {
+		return nil, err
+	}
+	grace, err := durationEnv("JANITOR_GRACE_PERIOD", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	config := janitor.Config{
+		Interval:    interval,
+		GracePeriod: grace,
+	}
+	if path := os.Getenv("JANITOR_ARCHIVE_FILE"); path != "" {
+		config.Archiver = janitor.NewFileArchiver(path)
+	}
+
+	return janitor.New(purger, logger, config), nil
+}
+
+// newURLChecker configures destination reputation checks from the
+// REPUTATION_* environment variables. It returns a nil checker if no
+// reputation source is configured.
+func newURLChecker() (reputation.URLChecker, reputation.Action, error) {
+	var checkers reputation.MultiChecker
+	if path := os.Getenv("REPUTATION_BLOCKLIST_FILE"); path != "" {
+		checker, err := reputation.LoadFileChecker(path)
+		if err != nil {
+			return nil, "", err
+		}
+		checkers = append(checkers, checker)
+	}
+	if endpoint := os.Getenv("REPUTATION_LOOKUP_URL"); endpoint != "" {
+		checkers = append(checkers, reputation.NewHashPrefixClient(reputation.HashPrefixConfig{
+			Endpoint: endpoint,
+			APIKey:   os.Getenv("REPUTATION_LOOKUP_KEY"),
+		}))
+	}
+	if len(checkers) == 0 {
+		return nil, "", nil
+	}
+
+	action := reputation.Action(os.Getenv("REPUTATION_ACTION"))
+	switch action {
+	case "":
+		action = reputation.ActionReject
+	case reputation.ActionReject, reputation.ActionWarn:
+	default:
+		return nil, "", fmt.Errorf("unknown reputation action %q", action)
+	}
+
+	ttl, err := durationEnv("REPUTATION_CACHE_TTL", time.Hour)
+	if err != nil {
+		return nil, "", err
+	}
+	return reputation.NewCachingChecker(checkers, ttl), action, nil
+}
+
+// newRedisClient connects to the server named by REDIS_URL
+func newRedisClient() (*redis.Client, error) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		redisURL = "redis://localhost:6379/0"
+	}
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse REDIS_URL: %w", err)
+	}
+	return redis.NewClient(opts), nil
+}
+
+// newRateLimiter configures per-client rate limiting from the
+// RATE_LIMIT_CREATE, RATE_LIMIT_STATS and RATE_LIMIT_REDIRECT environment
+// variables. It returns nil if no limit is set. Bucket state is kept in
+// memory unless RATE_LIMIT_BACKEND is "redis".
+func newRateLimiter(logger middleware.Logger) (func(http.Handler) http.Handler, error) {
+	limits := make(map[string]ratelimit.Limit)
+	for class, name := range map[string]string{
+		ratelimit.ClassCreate:   "RATE_LIMIT_CREATE",
+		ratelimit.ClassStats:    "RATE_LIMIT_STATS",
+		ratelimit.ClassRedirect: "RATE_LIMIT_REDIRECT",
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		limits[class] = limit
+	}
+	if len(limits) == 0 {
+		return nil, nil
+	}
+
+	store, err := newRateLimitStore()
+	if err != nil {
+		return nil, err
+	}
+	return ratelimit.Middleware(store, logger, ratelimit.Config{Limits: limits}), nil
+}
+
+// newRateLimitStore creates the token bucket store selected by
+// RATE_LIMIT_BACKEND: "memory" (default) or "redis"
+func newRateLimitStore() (ratelimit.Store, error) {
+	switch backend := os.Getenv("RATE_LIMIT_BACKEND"); backend {
+	case "", "memory":
+		return ratelimit.NewMemoryStore(), nil
+	case "redis":
+		client, err := newRedisClient()
+		if err != nil {
+			return nil, err
+		}
+		return ratelimit.NewRedisStore(client, ""), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", backend)
+	}
+}
+
+// newPasswordOptions configures password-protected links: attempts are
+// limited by PASSWORD_ATTEMPT_LIMIT in the rate limit backend, and unlock
+// cookies are signed with COOKIE_SECRET
+func newPasswordOptions(logger middleware.Logger) ([]api.Option, error) {
+	limit := api.DefaultPasswordAttemptLimit
+	if value := os.Getenv("PASSWORD_ATTEMPT_LIMIT"); value != "" {
+		var err error
+		limit, err = ratelimit.ParseLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PASSWORD_ATTEMPT_LIMIT: %w", err)
+		}
+	}
+	store, err := newRateLimitStore()
+	if err != nil {
+		return nil, err
+	}
+	options := []api.Option{api.WithPasswordThrottle(store, limit)}
+
+	if secret := os.Getenv("COOKIE_SECRET"); secret != "" {
+		options = append(options, api.WithCookieSecret([]byte(secret)))
+	} else {
+		logger.Info("COOKIE_SECRET is not set; unlocked links ask for their password again after a restart", nil)
+	}
+	return options, nil
+}
+
+// listEnv splits a comma-separated environment variable, skipping empty
+// entries
+func listEnv(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// durationEnv parses the environment variable name as a time.Duration,
+// returning fallback when it is unset
+func durationEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
 	}
+	return d, nil
 }